@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const compileTimeout = 30 * time.Second
+
+// compileCommand returns command checking that source file compiles, nil if the language is not supported.
+func compileCommand(lang, file string) []string {
+	switch {
+	case strings.Contains(lang, "g++"):
+		return []string{"g++", "-fsyntax-only", file}
+	case strings.Contains(lang, "gcc"):
+		return []string{"gcc", "-fsyntax-only", file}
+	case strings.Contains(lang, "python"):
+		return []string{"python3", "-m", "py_compile", file}
+	default:
+		return nil
+	}
+}
+
+// CompileResult is a compile check of a source as written to compile.json.
+type CompileResult struct {
+	RunID     int
+	ProblemID string
+	Language  string
+	Compiles  bool
+	// Output of the compiler if the source does not compile.
+	Output string `json:",omitempty"`
+}
+
+// VerifyCompile compiles sources with local toolchains and sets CompilesLocally.
+// Languages without a toolchain are skipped and missing from the results.
+func VerifyCompile(ctx context.Context, submissions []*Submission) ([]CompileResult, error) {
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	results := make([]CompileResult, 0, len(submissions))
+
+	for _, submission := range submissions {
+		log := log.With(zap.Int("run_id", submission.RunID), zap.String("language", submission.Language))
+		if submission.Source == nil {
+			continue
+		}
+		args := compileCommand(submission.Language, "")
+		if args == nil {
+			log.Debug("compile check not supported")
+			continue
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			log.Debug("compiler not found", zap.String("compiler", args[0]))
+			continue
+		}
+
+		file := filepath.Join(dir, fileName(submission.Language))
+		if err := ioutil.WriteFile(file, submission.Source, 0644); err != nil {
+			return results, err
+		}
+		args = compileCommand(submission.Language, file)
+
+		cctx, cancel := context.WithTimeout(ctx, compileTimeout)
+		out, err := exec.CommandContext(cctx, args[0], args[1:]...).CombinedOutput()
+		cancel()
+		submission.CompilesLocally = err == nil
+		result := CompileResult{
+			RunID:     submission.RunID,
+			ProblemID: submission.ProblemID,
+			Language:  submission.Language,
+			Compiles:  submission.CompilesLocally,
+		}
+		if err != nil {
+			log.Warn("source does not compile", zap.Error(err), zap.ByteString("output", out))
+			result.Output = string(out)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
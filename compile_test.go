@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyCompile(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	submissions := []*Submission{
+		{RunID: 1, ProblemID: "A", Language: "gcc", Source: []byte("int main(void) { return 0; }\n")},
+		{RunID: 2, ProblemID: "B", Language: "gcc", Source: []byte("int main(void) { return }\n")},
+		{RunID: 3, ProblemID: "C", Language: "fpc", Source: []byte("begin end.\n")},
+	}
+	results, err := VerifyCompile(context.Background(), submissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !submissions[0].CompilesLocally || submissions[1].CompilesLocally {
+		t.Errorf("got compiles %v, %v", submissions[0].CompilesLocally, submissions[1].CompilesLocally)
+	}
+	if len(results) != 2 || !results[0].Compiles || results[1].Compiles || results[1].Output == "" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	stubPdf(t)
+	p := &Parser{VerifyCompile: true, compiled: results}
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	var written []CompileResult
+	if err := json.Unmarshal(sink["compile.json"], &written); err != nil {
+		t.Fatalf("decode compile.json: %v", err)
+	}
+	if !reflect.DeepEqual(written, results) {
+		t.Errorf("compile.json: got %+v, expected %+v", written, results)
+	}
+}
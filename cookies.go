@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// injectedCookie is a cookie given with -cookie or -cookie-file and the url it is set for.
+type injectedCookie struct {
+	u      *url.URL
+	cookie *http.Cookie
+}
+
+func validateCookie(name, value string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n;,=\"()<>@:\\/[]?{}") {
+		return fmt.Errorf("invalid cookie name %q", name)
+	}
+	if strings.ContainsAny(value, " \t\r\n;,\"\\") {
+		return fmt.Errorf("invalid value of cookie %q", name)
+	}
+	return nil
+}
+
+// readCookieFile reads cookies in Netscape format exported by browsers and curl.
+func readCookieFile(path string) ([]injectedCookie, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cookies []injectedCookie
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		httpOnly := strings.HasPrefix(text, "#HttpOnly_")
+		if httpOnly {
+			text = strings.TrimPrefix(text, "#HttpOnly_")
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab separated fields, got %d", path, line, len(fields))
+		}
+		domain, subdomains, cookiePath, secure, expires, name, value := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+		if err := validateCookie(name, value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		cookie := &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     cookiePath,
+			Secure:   strings.EqualFold(secure, "TRUE"),
+			HttpOnly: httpOnly,
+		}
+		host := strings.TrimPrefix(domain, ".")
+		if strings.EqualFold(subdomains, "TRUE") {
+			cookie.Domain = host
+		}
+		if sec, err := strconv.ParseInt(expires, 10, 64); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiration %q", path, line, expires)
+		} else if sec != 0 {
+			cookie.Expires = time.Unix(sec, 0)
+		}
+
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		cookies = append(cookies, injectedCookie{
+			u:      &url.URL{Scheme: scheme, Host: host, Path: cookiePath},
+			cookie: cookie,
+		})
+	}
+	return cookies, scanner.Err()
+}
+
+// loadCookies collects cookies of -cookie flags set for the contest url and of -cookie-file.
+func (p *Parser) loadCookies() error {
+	base, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return err
+	}
+	p.cookies = nil
+	for name, values := range p.Cookies {
+		for _, value := range values {
+			if err := validateCookie(name, value); err != nil {
+				return err
+			}
+			p.cookies = append(p.cookies, injectedCookie{
+				u:      base,
+				cookie: &http.Cookie{Name: name, Value: value, Path: "/"},
+			})
+		}
+	}
+	if p.CookieFile != "" {
+		cookies, err := readCookieFile(p.CookieFile)
+		if err != nil {
+			return fmt.Errorf("read cookie file: %w", err)
+		}
+		p.cookies = append(p.cookies, cookies...)
+	}
+	return nil
+}
+
+func (p *Parser) injectCookies(jar http.CookieJar) {
+	for _, c := range p.cookies {
+		jar.SetCookies(c.u, []*http.Cookie{c.cookie})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadCookieFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cookies.txt")
+	raw := "# Netscape HTTP Cookie File\n\n" +
+		"#HttpOnly_.contest.example\tTRUE\t/\tTRUE\t1700000000\tEJSID\tabc\n" +
+		"contest.example\tFALSE\t/cgi-bin\tFALSE\t0\tlang\tru\n"
+	if err := ioutil.WriteFile(path, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cookies, err := readCookieFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("got %d cookies, expected 2", len(cookies))
+	}
+	session, lang := cookies[0], cookies[1]
+	if session.u.String() != "https://contest.example/" || session.cookie.Domain != "contest.example" ||
+		!session.cookie.Secure || !session.cookie.HttpOnly || !session.cookie.Expires.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("got session cookie %v for %v", session.cookie, session.u)
+	}
+	if lang.u.String() != "http://contest.example/cgi-bin" || lang.cookie.Domain != "" || !lang.cookie.Expires.IsZero() {
+		t.Errorf("got lang cookie %v for %v", lang.cookie, lang.u)
+	}
+
+	for name, line := range map[string]string{
+		"fields":     "contest.example\tFALSE\t/\tFALSE\t0\tEJSID\n",
+		"expiration": "contest.example\tFALSE\t/\tFALSE\tnever\tEJSID\tabc\n",
+		"name":       "contest.example\tFALSE\t/\tFALSE\t0\tEJ SID\tabc\n",
+	} {
+		bad := filepath.Join(dir, name+".txt")
+		if err := ioutil.WriteFile(bad, []byte("# comment\n"+line), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readCookieFile(bad); err == nil || !strings.HasPrefix(err.Error(), bad+":2:") {
+			t.Errorf("%s: expected error on line 2, got %v", name, err)
+		}
+	}
+}
+
+func TestInjectCookies(t *testing.T) {
+	var sent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Store(r.Header.Get("Cookie"))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	p.Cookies = paramsFlag{"EJSID": {"abc"}}
+	cli, err := p.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := cli.Get(srv.URL + "/contest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, _ := sent.Load().(string); got != "EJSID=abc" {
+		t.Errorf("got cookie header %q", got)
+	}
+
+	p.Cookies = paramsFlag{"EJSID": {"a;b"}}
+	if _, err := p.newClient(); err == nil {
+		t.Error("expected error on invalid cookie value")
+	}
+}
+
+func TestSkipLogin(t *testing.T) {
+	var logins int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/team.cgi" {
+			atomic.AddInt32(&logins, 1)
+		}
+		if cookie, err := r.Cookie("EJSID"); err != nil || cookie.Value != "abc" {
+			w.Write([]byte(selfTestPages["/team.cgi"]))
+			return
+		}
+		selfTestHandler(w, r)
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/contest")
+	p.SkipLogin = true
+	if _, err := p.newClient(); err == nil {
+		t.Fatal("expected error without session cookies")
+	}
+
+	p.Cookies = paramsFlag{"EJSID": {"abc"}}
+	cli, err := p.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.cli = cli
+	if err := p.GetData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&logins); got != 0 {
+		t.Errorf("got %d login requests, expected none", got)
+	}
+	if len(p.Problems) != 2 || len(p.Runs) != 3 {
+		t.Errorf("got %d problems and %d runs", len(p.Problems), len(p.Runs))
+	}
+}
+
+func TestInjectedCookiesAfterContestMismatch(t *testing.T) {
+	var logins int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Write([]byte(selfTestPages["/team.cgi"]))
+			return
+		}
+		atomic.AddInt32(&logins, 1)
+		if _, err := r.Cookie("EJSID"); err == nil {
+			// the injected session belongs to another contest
+			w.Write([]byte(strings.Replace(contestPage, `value="1"`, `value="2"`, 1)))
+			return
+		}
+		w.Write([]byte(contestPage))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	p.Cookies = paramsFlag{"EJSID": {"other"}}
+	cli, err := p.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.cli = cli
+	if _, err := p.login(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&logins); got != 2 {
+		t.Errorf("got %d logins, expected 2", got)
+	}
+	u, _ := url.Parse(srv.URL)
+	if len(p.cli.Jar.Cookies(u)) != 0 {
+		t.Error("injected cookie is set again after contest mismatch")
+	}
+
+	// a session of the next role starts with the injected cookies
+	if err := p.resetSession(true); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := p.cli.Jar.Cookies(u); len(cookies) != 1 || cookies[0].Value != "other" {
+		t.Errorf("got cookies %v after role reset", cookies)
+	}
+}
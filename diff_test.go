@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	from := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n")
+	to := []byte("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n")
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	if got := unifiedDiff("old", "new", from, to); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+	if got := unifiedDiff("old", "new", from, from); got != "" {
+		t.Errorf("equal sources: got %q", got)
+	}
+	if got := unifiedDiff("old", "new", nil, []byte("x\n")); got != "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("new file: got %q", got)
+	}
+}
+
+func TestDiffAttempts(t *testing.T) {
+	runs := []*Submission{
+		{RunID: 4, ProblemID: "A", Source: []byte("late\n")},
+		{RunID: 3, ProblemID: "A", OK: true, Source: []byte("ok\n")},
+		{RunID: 2, ProblemID: "B", Source: []byte("last\n")},
+		{RunID: 1, ProblemID: "A", Source: []byte("wrong\n")},
+	}
+	diffAttempts(runs)
+
+	if runs[0].Diff != "" || runs[1].Diff != "" || runs[2].Diff != "" {
+		t.Errorf("final runs and runs after the accepted one must not have diffs: %q, %q, %q", runs[0].Diff, runs[1].Diff, runs[2].Diff)
+	}
+	if expected := "--- run-1\n+++ run-3\n@@ -1,1 +1,1 @@\n-wrong\n+ok\n"; runs[3].Diff != expected {
+		t.Errorf("got %q, expected %q", runs[3].Diff, expected)
+	}
+}
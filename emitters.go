@@ -3,11 +3,13 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -17,13 +19,34 @@ import (
 	"golang.org/x/net/html"
 )
 
-func GeneratePdf(r io.Reader, w io.Writer) error {
+// pdfPage sets utf-8 charset and font of the page, so wkhtmltopdf does not lose non-latin text.
+func pdfPage(raw, font string) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	head := doc.Find(`head`)
+	head.Find(`meta[charset], meta[http-equiv]`).Remove()
+	head.PrependHtml(`<meta charset="utf-8">`)
+	if font != "" {
+		// style content is raw text, drop characters which could close the rule or the tag
+		font = strings.NewReplacer("<", "", ">", "", "{", "", "}", "", ";", "").Replace(font)
+		head.AppendHtml(fmt.Sprintf(`<style>body, table { font-family: %s; }</style>`, font))
+	}
+	return doc.Html()
+}
+
+func GeneratePdf(raw, font string, w io.Writer) error {
+	raw, err := pdfPage(raw, font)
+	if err != nil {
+		return err
+	}
 	gen, err := wkhtmltopdf.NewPDFGenerator()
 	if err != nil {
 		return err
 	}
 	gen.Orientation.Set("landscape")
-	page := wkhtmltopdf.NewPageReader(r)
+	page := wkhtmltopdf.NewPageReader(strings.NewReader(raw))
 	page.Encoding.Set("utf8")
 	gen.AddPage(page)
 	if err := gen.Create(); err != nil {
@@ -33,23 +56,140 @@ func GeneratePdf(r io.Reader, w io.Writer) error {
 	return err
 }
 
+// generatePdf is replaced in tests, so output can be checked without wkhtmltopdf.
+var generatePdf = GeneratePdf
+
 type Emitter interface {
 	Emit(context.Context, *goquery.Selection) error
 }
 
+// cellText returns trimmed text of the cell. Entities are already decoded by goquery, so text like "&lt;" shown
+// on the page is kept as is.
+func cellText(s *goquery.Selection) string {
+	return strings.TrimSpace(strings.Replace(s.Text(), "\u00a0", " ", -1))
+}
+
 func eachCol(ss *[]string) func(i int, s *goquery.Selection) {
 	return func(i int, s *goquery.Selection) {
-		*ss = append(*ss, s.Text())
+		*ss = append(*ss, cellText(s))
 	}
 }
 
-type HrefEmitter struct {
+// resolveHref resolves href against base. http links to the host of an https page are upgraded to https,
+// so they do not downgrade the connection. Links are never downgraded.
+func resolveHref(base *url.URL, href string) (*url.URL, error) {
+	u, err := base.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == base.Host && u.Scheme == "http" && base.Scheme == "https" {
+		log.Warn("http link on https page would downgrade connection, upgrading", zap.Stringer("url", u))
+		u.Scheme = "https"
+	}
+	return u, nil
+}
+
+type LoginFormEmitter struct {
 	originalHref *url.URL
 
+	Action *url.URL
+	// Method is GET only if the form declares it, POST otherwise.
+	Method        string
+	LoginField    string
+	PasswordField string
+	// Hidden contains hidden inputs of the form (e.g. csrf tokens) which must be sent back.
+	Hidden url.Values
+}
+
+func (l *LoginFormEmitter) Emit(_ context.Context, doc *goquery.Selection) error {
+	form := doc.Find(`form`).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.Find(`input[type=password][name]`).Length() != 0
+	}).First()
+	if form.Length() == 0 {
+		return fmt.Errorf("login form not found")
+	}
+
+	l.PasswordField, _ = form.Find(`input[type=password][name]`).Attr("name")
+	login, found := form.Find(`input[type=text][name], input[name]:not([type])`).First().Attr("name")
+	if !found {
+		return fmt.Errorf("login input not found")
+	}
+	l.LoginField = login
+
+	l.Hidden = make(url.Values)
+	form.Find(`input[type=hidden][name]`).Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		value, _ := s.Attr("value")
+		l.Hidden.Add(name, value)
+	})
+
+	l.Method = http.MethodPost
+	if method, _ := form.Attr("method"); strings.EqualFold(strings.TrimSpace(method), http.MethodGet) {
+		l.Method = http.MethodGet
+	}
+
+	l.Action = l.originalHref
+	if action, found := form.Attr("action"); found && action != "" {
+		u, err := resolveHref(l.originalHref, action)
+		if err != nil {
+			return fmt.Errorf("parse form action: %w", err)
+		}
+		l.Action = u
+	}
+	return nil
+}
+
+// findTable returns the b1 table titled by caption or nearest preceding heading containing one of titles, ignoring case.
+// The first b1 table is returned if none is titled.
+func findTable(doc *goquery.Selection, titles ...string) *goquery.Selection {
+	tables := doc.Find(`table.b1`)
+	titled := tables.FilterFunction(func(_ int, tbl *goquery.Selection) bool {
+		title := tbl.ChildrenFiltered(`caption`).Text()
+		if title == "" {
+			title = tbl.PrevAllFiltered(`h1, h2, h3, h4`).First().Text()
+		}
+		title = strings.ToLower(title)
+		for _, t := range titles {
+			if strings.Contains(title, strings.ToLower(t)) {
+				return true
+			}
+		}
+		return false
+	})
+	if titled.Length() != 0 {
+		return titled.First()
+	}
+	return tables.First()
+}
+
+// tableRows returns header and data rows of the table. The tbody wrapper may be absent in the markup.
+func tableRows(tbl *goquery.Selection) (header, rows *goquery.Selection) {
+	all := tbl.Find(`tr`).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		// skip rows of nested tables
+		return s.Closest(`table`).IsSelection(tbl)
+	})
+	header = all.FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.ChildrenFiltered(`th`).Length() != 0
+	}).First()
+	if header.Length() == 0 {
+		header = all.First()
+	}
+	return header, all.NotSelection(header)
+}
+
+type HrefEmitter struct {
+	originalHref      *url.URL
+	allRuns           bool
+	submissionsParams url.Values
+	// ownLogin restricts submissions to runs of the user, e.g. for judges.
+	ownLogin string
+
 	SummaryHref     *url.URL
 	StatementsHref  *url.URL
 	SubmissionsHref *url.URL
 	StandingsHref   *url.URL
+	// ContestTitle is the contest name from breadcrumbs or page title, empty if not found.
+	ContestTitle string
 }
 
 func (h *HrefEmitter) parseHref(text string, sel *goquery.Selection) (*url.URL, error) {
@@ -58,10 +198,122 @@ func (h *HrefEmitter) parseHref(text string, sel *goquery.Selection) (*url.URL,
 	if !found {
 		return nil, fmt.Errorf("%q href not found", text)
 	}
-	return h.originalHref.Parse(summary)
+	return resolveHref(h.originalHref, summary)
 }
 
-func (h *HrefEmitter) Emit(_ context.Context, doc *goquery.Selection) (err error) {
+var (
+	ErrContestNotStarted = errors.New("contest is not started")
+	// ErrContestFinished is returned if the contest is over and its pages are not available.
+	// Contests open for upsolving are scraped as usual.
+	ErrContestFinished = errors.New("contest is finished")
+)
+
+var (
+	notStartedMessages = []string{
+		"contest is not started",
+		"contest has not started",
+		"соревнование ещё не началось",
+		"соревнование еще не началось",
+	}
+	finishedMessages = []string{
+		"contest is over",
+		"contest is finished",
+		"соревнование закончилось",
+		"соревнование завершено",
+	}
+)
+
+func containsAny(text string, messages []string) bool {
+	text = strings.ToLower(text)
+	for _, msg := range messages {
+		if strings.Contains(text, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+var titleSuffixes = []string{" - ejudge", " — ejudge", " | ejudge"}
+
+// contestTitle extracts the contest name from the last breadcrumb item or the page title.
+func contestTitle(doc *goquery.Selection) string {
+	crumbs := doc.Find(`.breadcrumb li, .breadcrumbs li, .breadcrumb a, .breadcrumbs a`).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return strings.TrimSpace(s.Text()) != ""
+	})
+	title := strings.TrimSpace(crumbs.Last().Text())
+	if title == "" {
+		title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	for _, suffix := range titleSuffixes {
+		if len(title) >= len(suffix) && strings.EqualFold(title[len(title)-len(suffix):], suffix) {
+			title = strings.TrimSpace(title[:len(title)-len(suffix)])
+		}
+	}
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// ContestMismatchError is returned if the session leads to another contest than requested.
+type ContestMismatchError struct {
+	Want, Got int
+}
+
+func (e *ContestMismatchError) Error() string {
+	return fmt.Sprintf("logged in to contest %d instead of %d", e.Got, e.Want)
+}
+
+// pageContestID looks for the contest id in hidden form inputs and links of the page, then in the page url.
+func pageContestID(base *url.URL, doc *goquery.Selection) (int, bool) {
+	if raw, found := doc.Find(`input[name=contest_id]`).Attr("value"); found {
+		if id, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil {
+			return id, true
+		}
+	}
+	var (
+		id    int
+		found bool
+	)
+	doc.Find(`a[href*="contest_id="]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		u, err := url.Parse(href)
+		if err != nil {
+			return true
+		}
+		id, err = strconv.Atoi(u.Query().Get("contest_id"))
+		found = err == nil
+		return !found
+	})
+	if found {
+		return id, true
+	}
+	if base != nil {
+		if id, err := strconv.Atoi(base.Query().Get("contest_id")); err == nil {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (h *HrefEmitter) Emit(_ context.Context, doc *goquery.Selection) error {
+	text := doc.Text()
+	h.ContestTitle = contestTitle(doc)
+	if containsAny(text, notStartedMessages) {
+		return ErrContestNotStarted
+	}
+	finished := containsAny(text, finishedMessages)
+
+	if err := h.parseActions(doc); err != nil {
+		if finished {
+			return fmt.Errorf("%w: %v", ErrContestFinished, err)
+		}
+		return err
+	}
+	if finished {
+		log.Info("contest is finished, scraping upsolving")
+	}
+	return nil
+}
+
+func (h *HrefEmitter) parseActions(doc *goquery.Selection) (err error) {
 	actions := doc.Find(`[class=contest_actions_item]`)
 
 	h.SummaryHref, err = h.parseHref("Summary", actions)
@@ -79,16 +331,27 @@ func (h *HrefEmitter) Emit(_ context.Context, doc *goquery.Selection) (err error
 		return err
 	}
 
+	// statements page is present only in some contests
+	h.StatementsHref, _ = h.parseHref("Statements", actions)
+
 	submissions, err := h.parseHref("Submissions", actions)
 	if err != nil {
 		return err
 	}
-	// add parameter
+	// add parameters
 	q, err := url.ParseQuery(submissions.RawQuery)
 	if err != nil {
 		return err
 	}
-	q.Set("all_runs", "1")
+	if h.allRuns {
+		q.Set("all_runs", "1")
+	}
+	if h.ownLogin != "" {
+		q.Set("filter_expr", fmt.Sprintf("login == %q", h.ownLogin))
+	}
+	for name, values := range h.submissionsParams {
+		q[name] = values
+	}
 	submissions.RawQuery = q.Encode()
 	h.SubmissionsHref = submissions
 
@@ -96,27 +359,54 @@ func (h *HrefEmitter) Emit(_ context.Context, doc *goquery.Selection) (err error
 }
 
 type Problem struct {
-	ID    string
-	Name  string
-	RunID int
-	OK    bool
+	ID      string
+	Name    string
+	RunID   int
+	OK      bool
+	Tags    []string
+	Samples []SampleTest
+	// SolvedLanguages are languages of accepted runs of the problem.
+	SolvedLanguages []string
+	// Statement is the raw html of the statement page.
+	Statement string
+	// StatementPDF is the path of downloaded pdf statement relative to the output dir.
+	StatementPDF string
+
+	// probID is the numeric ejudge id of the problem, zero if unknown.
+	probID        int
+	statementHref *url.URL
+	pdfHref       *url.URL
+	pdf           []byte
+}
+
+type SampleTest struct {
+	Input, Output string
 }
 
 type ProblemsEmitter struct {
 	originalHref *url.URL
-	Problems     []*Problem
-	SummaryTable string
+	pdfFont      string
+	// skipBadRows makes rows failed to decode skipped instead of failing the parse.
+	skipBadRows    bool
+	Problems       []*Problem
+	ProblemHeaders []string
+	SummaryTable   string
+	// BadRows are decode errors of skipped rows.
+	BadRows []error
 }
 
 func (pe *ProblemsEmitter) Emit(_ context.Context, doc *goquery.Selection) error {
-	sel := doc.Find(`table[class=b1] > tbody > tr`)
+	tbl := findTable(doc, "Summary", "Problems")
+	if tbl.Length() == 0 {
+		return fmt.Errorf("summary table not found")
+	}
+	header, rows := tableRows(tbl)
 
-	tbl := doc.Find(`table[class=b1]`)
 	buf := new(bytes.Buffer)
 	link := doc.Find(`link[href]`)
 	href, found := link.Attr("href")
 	if found {
-		u, err := pe.originalHref.Parse(href)
+		u, err := resolveHref(pe.originalHref, href)
 		if err != nil {
 			return fmt.Errorf("change href address: %w", err)
 		}
@@ -131,22 +421,36 @@ func (pe *ProblemsEmitter) Emit(_ context.Context, doc *goquery.Selection) error
 		return err
 	}
 	pe.SummaryTable = buf.String()
-	// ioutil.WriteFile("out.html", buf.Bytes(), 0644)
 
 	var names []string
-	first := sel.First()
-	first.Children().Each(eachCol(&names))
+	header.Children().Each(eachCol(&names))
+	pe.ProblemHeaders = names
 
 	var errRet error
-	sel.Next().EachWithBreak(func(i int, s *goquery.Selection) bool {
+	rows.EachWithBreak(func(i int, s *goquery.Selection) bool {
 		var cols []string
 		s.Children().Each(eachCol(&cols))
 		problem, err := pe.decodeProblem(names, cols)
 		if err != nil {
+			if pe.skipBadRows {
+				log.Warn("skip problem row", zap.Error(err), zap.Strings("cols", cols))
+				pe.BadRows = append(pe.BadRows, fmt.Errorf("row %d: %w", i+1, err))
+				return true
+			}
 			errRet = err
 			log.Error("decode problem", zap.Error(err), zap.Strings("names", names), zap.Strings("cols", cols))
 			return false
 		}
+		if idx := colIndex(names, "Short name"); idx >= 0 {
+			if href, ok := s.Children().Eq(idx).Find(`a[href]`).Attr("href"); ok {
+				problem.statementHref, err = resolveHref(pe.originalHref, href)
+				if err != nil {
+					errRet = fmt.Errorf("parse statement href: %w", err)
+					return false
+				}
+				problem.probID, _ = strconv.Atoi(problem.statementHref.Query().Get("prob_id"))
+			}
+		}
 		pe.Problems = append(pe.Problems, problem)
 		return true
 	})
@@ -154,7 +458,28 @@ func (pe *ProblemsEmitter) Emit(_ context.Context, doc *goquery.Selection) error
 	return errRet
 }
 
+func colIndex(names []string, name string) int {
+	for idx, col := range names {
+		if col == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+// problemColumns maps summary table columns to the decoded Problem fields.
+var problemColumns = map[string]string{
+	"Short name": "ID",
+	"Long name":  "Name",
+	"Tags":       "Tags",
+	"Status":     "OK",
+	"Run ID":     "RunID",
+}
+
 func (pe *ProblemsEmitter) decodeProblem(names, cols []string) (res *Problem, err error) {
+	if len(cols) < len(names) {
+		return nil, fmt.Errorf("row has %d cells, expected %d", len(cols), len(names))
+	}
 	res = new(Problem)
 	for idx, name := range names {
 		switch name {
@@ -162,13 +487,20 @@ func (pe *ProblemsEmitter) decodeProblem(names, cols []string) (res *Problem, er
 			res.ID = cols[idx]
 		case "Long name":
 			res.Name = cols[idx]
+		case "Tags":
+			res.Tags = splitTags(cols[idx])
 		case "Status":
 			res.OK = cols[idx] == "OK"
 		case "Run ID":
 			if !res.OK {
 				continue
 			}
-			res.RunID, err = strconv.Atoi(cols[idx])
+			digits := firstNumber(cols[idx])
+			if digits == "" {
+				log.Warn("run id of accepted problem not found", zap.String("problem", res.ID), zap.String("value", cols[idx]))
+				continue
+			}
+			res.RunID, err = strconv.Atoi(digits)
 			if err != nil {
 				err = fmt.Errorf("decode run id: %w", err)
 			}
@@ -177,25 +509,179 @@ func (pe *ProblemsEmitter) decodeProblem(names, cols []string) (res *Problem, er
 	return
 }
 
+// firstNumber returns the first sequence of digits in raw.
+func firstNumber(raw string) string {
+	notDigit := func(r rune) bool { return r < '0' || r > '9' }
+	start := strings.IndexFunc(raw, func(r rune) bool { return !notDigit(r) })
+	if start < 0 {
+		return ""
+	}
+	raw = raw[start:]
+	if end := strings.IndexFunc(raw, notDigit); end >= 0 {
+		raw = raw[:end]
+	}
+	return raw
+}
+
+func splitTags(raw string) (tags []string) {
+	for _, tag := range strings.Split(raw, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 func (pe *ProblemsEmitter) GeneratePdf(w io.Writer) error {
-	return GeneratePdf(strings.NewReader(pe.SummaryTable), w)
+	return generatePdf(pe.SummaryTable, pe.pdfFont, w)
+}
+
+// StatementEmitter parses sample tests from the problem statement page.
+var sampleHeading = regexp.MustCompile(`(?i)example|sample|input|output|пример|ввод|вывод|входн|выходн`)
+
+// samplePres returns pre blocks following example, input or output headings, so code in the legend is not taken for samples.
+func samplePres(doc *goquery.Selection) []*goquery.Selection {
+	var (
+		pres      []*goquery.Selection
+		inExample bool
+	)
+	doc.Find(`h1, h2, h3, h4, h5, h6, .section-title, pre`).Each(func(_ int, s *goquery.Selection) {
+		if goquery.NodeName(s) != "pre" {
+			inExample = sampleHeading.MatchString(s.Text())
+			return
+		}
+		if inExample {
+			pres = append(pres, s)
+		}
+	})
+	return pres
+}
+
+type StatementEmitter struct {
+	Problem *Problem
+}
+
+func (st *StatementEmitter) Emit(_ context.Context, doc *goquery.Selection) error {
+	var samples []SampleTest
+	// usually examples are rendered as a table with input and output cells
+	doc.Find(`tr`).Each(func(_ int, row *goquery.Selection) {
+		// skip layout rows wrapping nested tables
+		if row.Find(`tr`).Length() != 0 {
+			return
+		}
+		pres := row.ChildrenFiltered(`td`).Find(`pre`)
+		if pres.Length() < 2 {
+			return
+		}
+		samples = append(samples, SampleTest{
+			Input:  pres.Eq(0).Text(),
+			Output: pres.Eq(1).Text(),
+		})
+	})
+
+	// otherwise input and output blocks follow each other under example headings
+	if len(samples) == 0 {
+		pres := samplePres(doc)
+		if len(pres)%2 != 0 {
+			log.Warn("odd number of sample blocks", zap.String("problem", st.Problem.ID), zap.Int("count", len(pres)))
+			pres = nil
+		}
+		for idx := 0; idx < len(pres); idx += 2 {
+			samples = append(samples, SampleTest{
+				Input:  pres[idx].Text(),
+				Output: pres[idx+1].Text(),
+			})
+		}
+	}
+
+	st.Problem.Samples = samples
+
+	pdf := doc.Find(`a[href]`).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		href, _ := s.Attr("href")
+		return strings.HasSuffix(strings.ToLower(href), ".pdf")
+	}).First()
+	if href, ok := pdf.Attr("href"); ok {
+		u, err := resolveHref(st.Problem.statementHref, href)
+		if err != nil {
+			return fmt.Errorf("parse pdf href: %w", err)
+		}
+		st.Problem.pdfHref = u
+	}
+
+	raw, err := doc.Html()
+	st.Problem.Statement = raw
+	return err
 }
 
 type Submission struct {
-	ProblemID  string
-	Language   string
-	sourceHref *url.URL
-	Source     []byte
-	OK         bool
+	RunID int
+	// Time is the submit time as shown by the server.
+	Time        string
+	ProblemID   string
+	Language    string
+	RawLanguage string
+	sourceHref  *url.URL
+	// sourceMethod and sourceForm are set if the source is opened by a form instead of a link.
+	sourceMethod string
+	sourceForm   url.Values
+	Source       []byte
+	Result       string
+	OK           bool
+	MaxTimeMS    int
+	MaxMemoryKB  int
+	// TestsPassed and TestsTotal are parsed from "12/30" in the result, zero if there is no fraction.
+	TestsPassed int
+	TestsTotal  int
+	// Diff is unified diff against the final accepted source of the problem.
+	Diff string
+	// Binary is set if the view link returned non-text content.
+	Binary bool
+	// CompilesLocally is set by -verify-compile if the source compiles with a local toolchain.
+	CompilesLocally bool
+
+	// path of the source relative to the output dir
+	path string
+	// streamed is set if the source is already written by -stream-sources
+	streamed bool
 }
 
 type SubmissionsEmitter struct {
-	cli         *http.Client
+	originalHref *url.URL
+	cli          *http.Client
+	cached       func(*Submission) ([]byte, bool)
+	languages    map[string]string
+	// runIDs restricts submissions to the given runs, all of them are kept without dedup.
+	runIDs map[int]bool
+	// problemID restricts runs to a single problem.
+	problemID string
+	// allSources enables fetching sources of all runs, not only of deduplicated submissions.
+	allSources bool
+	skipBinary bool
+	maxSize    int64
+	retries    int
+	// progress is called while a source is downloaded.
+	progress func(u *url.URL, read, total int64)
+	// onSource takes every fetched source, the source is not kept after it.
+	onSource    func(*Submission) error
 	Submissions []*Submission
+	// Runs contains every row of the submissions table, newest first.
+	Runs              []*Submission
+	SubmissionHeaders []string
+	SubmissionsTable  string
 }
 
 func (se *SubmissionsEmitter) Emit(ctx context.Context, doc *goquery.Selection) error {
-	sel := doc.Find(`table[class=b1] > tbody > tr`)
+	tbl := findTable(doc, "Submissions", "Runs")
+	if tbl.Length() == 0 {
+		return fmt.Errorf("submissions table not found")
+	}
+	header, rows := tableRows(tbl)
+
+	buf := new(bytes.Buffer)
+	if err := html.Render(buf, tbl.Nodes[0]); err != nil {
+		return err
+	}
+	se.SubmissionsTable = buf.String()
 
 	var (
 		names             []string
@@ -203,10 +689,10 @@ func (se *SubmissionsEmitter) Emit(ctx context.Context, doc *goquery.Selection)
 		errRet            error
 	)
 
-	first := sel.First()
-	first.Children().Each(eachCol(&names))
+	header.Children().Each(eachCol(&names))
+	se.SubmissionHeaders = names
 
-	sel.Next().EachWithBreak(func(i int, s *goquery.Selection) bool {
+	rows.EachWithBreak(func(i int, s *goquery.Selection) bool {
 		var cols []string
 		s.Children().Each(eachCol(&cols))
 		submission, err := se.decodeSubmission(names, cols)
@@ -215,17 +701,21 @@ func (se *SubmissionsEmitter) Emit(ctx context.Context, doc *goquery.Selection)
 			log.Error("decode problem", zap.Error(err), zap.Strings("names", names), zap.Strings("cols", cols))
 			return false
 		}
-		href, ok := s.Children().Find(`a:contains("View")[href]`).Attr("href")
-		if !ok {
-			errRet = fmt.Errorf("href to source not found")
-			return false
+		if se.problemID != "" && submission.ProblemID != se.problemID {
+			return true
 		}
-		submission.sourceHref, err = url.Parse(href)
-		if err != nil {
+		if err := se.parseSourceLink(s, submission); err != nil {
 			errRet = err
 			return false
 		}
 
+		se.Runs = append(se.Runs, submission)
+		if se.runIDs != nil {
+			if se.runIDs[submission.RunID] {
+				se.Submissions = append(se.Submissions, submission)
+			}
+			return true
+		}
 		if _, ok := uniqueSubmissions[submission.ProblemID]; ok {
 			return true
 		}
@@ -236,77 +726,392 @@ func (se *SubmissionsEmitter) Emit(ctx context.Context, doc *goquery.Selection)
 	if errRet != nil {
 		return errRet
 	}
+	se.reportMissingRuns()
 
-	return se.loadSource(ctx)
+	if se.allSources {
+		return se.loadSource(ctx, se.Runs)
+	}
+	return se.loadSource(ctx, se.Submissions)
+}
+
+// parseSourceLink finds the "View" link of the row, or the "View" form button used by some skins instead.
+func (se *SubmissionsEmitter) parseSourceLink(row *goquery.Selection, submission *Submission) (err error) {
+	if href, ok := row.Children().Find(`a:contains("View")[href]`).Attr("href"); ok {
+		submission.sourceHref, err = resolveHref(se.originalHref, href)
+		return err
+	}
+
+	button := `input[type=submit][value*="View"], button:contains("View")`
+	form := row.Find(`form`).FilterFunction(func(_ int, f *goquery.Selection) bool {
+		return f.Find(button).Length() != 0
+	}).First()
+	if form.Length() == 0 {
+		return fmt.Errorf("href to source not found")
+	}
+
+	action, _ := form.Attr("action")
+	if submission.sourceHref, err = resolveHref(se.originalHref, action); err != nil {
+		return fmt.Errorf("parse view form action: %w", err)
+	}
+	submission.sourceMethod = http.MethodGet
+	if method, _ := form.Attr("method"); strings.EqualFold(strings.TrimSpace(method), http.MethodPost) {
+		submission.sourceMethod = http.MethodPost
+	}
+	submission.sourceForm = make(url.Values)
+	form.Find(`input[type=hidden][name]`).AddSelection(form.Find(button).Filter(`[name]`).First()).Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		value, _ := s.Attr("value")
+		submission.sourceForm.Add(name, value)
+	})
+	return nil
+}
+
+func (se *SubmissionsEmitter) reportMissingRuns() {
+	if se.runIDs == nil {
+		return
+	}
+	found := make(map[int]bool, len(se.Submissions))
+	for _, submission := range se.Submissions {
+		found[submission.RunID] = true
+	}
+	for runID := range se.runIDs {
+		if !found[runID] {
+			log.Warn("run not found in submissions table", zap.Int("run_id", runID))
+		}
+	}
+}
+
+// submissionColumns maps submissions table columns to the decoded Submission fields.
+var submissionColumns = map[string]string{
+	"Run ID":      "RunID",
+	"Time":        "Time",
+	"Problem":     "ProblemID",
+	"Language":    "Language",
+	"Result":      "Result",
+	"Max time":    "MaxTimeMS",
+	"Time used":   "MaxTimeMS",
+	"Max memory":  "MaxMemoryKB",
+	"Memory used": "MaxMemoryKB",
+}
+
+// FieldSources returns the column each field is decoded from, or "not found".
+func FieldSources(names []string, columns map[string]string) map[string]string {
+	res := make(map[string]string)
+	for _, field := range columns {
+		res[field] = "not found"
+	}
+	for idx, name := range names {
+		if field, ok := columns[name]; ok {
+			res[field] = fmt.Sprintf("column %d %q", idx, name)
+		}
+	}
+	return res
 }
 
 func (se *SubmissionsEmitter) decodeSubmission(names, cols []string) (res *Submission, err error) {
 	res = new(Submission)
 	for idx, name := range names {
 		switch name {
+		case "Run ID":
+			// the cell may be decorated, e.g. "12*" for runs of other users
+			digits := firstNumber(cols[idx])
+			if digits == "" {
+				log.Warn("run id not found", zap.String("value", cols[idx]))
+				continue
+			}
+			if res.RunID, err = strconv.Atoi(digits); err != nil {
+				log.Warn("decode run id", zap.String("value", cols[idx]), zap.Error(err))
+				res.RunID, err = 0, nil
+			}
 		case "Problem":
 			res.ProblemID = cols[idx]
 		case "Language":
+			res.RawLanguage = cols[idx]
 			res.Language = cols[idx]
+			if se.languages != nil {
+				res.Language = resolveLanguage(se.languages, cols[idx])
+			}
+		case "Time":
+			res.Time = strings.TrimSpace(cols[idx])
 		case "Result":
+			res.Result = cols[idx]
 			res.OK = cols[idx] == "OK"
+			res.TestsPassed, res.TestsTotal = parseTestsFraction(cols[idx])
+		case "Max time", "Time used":
+			// rows of compilation errors have "N/A" or "-" here, usage is left unknown
+			if res.MaxTimeMS, err = parseTimeMS(cols[idx]); err != nil {
+				log.Warn("decode max time", zap.Int("run_id", res.RunID), zap.String("value", cols[idx]), zap.Error(err))
+				res.MaxTimeMS, err = 0, nil
+			}
+		case "Max memory", "Memory used":
+			if res.MaxMemoryKB, err = parseMemoryKB(cols[idx]); err != nil {
+				log.Warn("decode max memory", zap.Int("run_id", res.RunID), zap.String("value", cols[idx]), zap.Error(err))
+				res.MaxMemoryKB, err = 0, nil
+			}
 		}
 	}
 	return
 }
 
-func (se *SubmissionsEmitter) loadSource(ctx context.Context) error {
-	for _, submission := range se.Submissions {
-		raw, err := se.fetchSource(ctx, submission.sourceHref)
+var testsFraction = regexp.MustCompile(`(\d+)\s*/\s*(\d+)`)
+
+// parseTestsFraction parses number of passed and total tests from result like "Partial solution 12/30".
+func parseTestsFraction(raw string) (passed, total int) {
+	m := testsFraction.FindStringSubmatch(raw)
+	if m == nil {
+		return 0, 0
+	}
+	passed, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, 0
+	}
+	total, err = strconv.Atoi(m[2])
+	if err != nil || passed > total {
+		return 0, 0
+	}
+	return passed, total
+}
+
+// splitUnit splits "3.5M" or "120 ms" into number and lowercased unit.
+func splitUnit(raw string) (float64, string, error) {
+	raw = strings.TrimSpace(raw)
+	end := strings.IndexFunc(raw, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == ',')
+	})
+	if end < 0 {
+		end = len(raw)
+	}
+	num := strings.Replace(raw[:end], ",", ".", 1)
+	val, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return val, strings.ToLower(strings.TrimSpace(raw[end:])), nil
+}
+
+// parseTimeMS parses time usage, unitless values are milliseconds.
+func parseTimeMS(raw string) (int, error) {
+	if strings.TrimSpace(raw) == "" {
+		return 0, nil
+	}
+	val, unit, err := splitUnit(raw)
+	if err != nil {
+		return 0, err
+	}
+	switch unit {
+	case "", "ms", "msec":
+	case "s", "sec":
+		val *= 1000
+	default:
+		return 0, fmt.Errorf("unknown time unit %q", unit)
+	}
+	return int(val + 0.5), nil
+}
+
+// parseMemoryKB parses memory usage, unitless values are kilobytes.
+func parseMemoryKB(raw string) (int, error) {
+	if strings.TrimSpace(raw) == "" {
+		return 0, nil
+	}
+	val, unit, err := splitUnit(raw)
+	if err != nil {
+		return 0, err
+	}
+	switch unit {
+	case "", "k", "kb":
+	case "b":
+		val /= 1024
+	case "m", "mb":
+		val *= 1024
+	case "g", "gb":
+		val *= 1024 * 1024
+	default:
+		return 0, fmt.Errorf("unknown memory unit %q", unit)
+	}
+	return int(val + 0.5), nil
+}
+
+func (se *SubmissionsEmitter) loadSource(ctx context.Context, submissions []*Submission) error {
+	for _, submission := range submissions {
+		if se.cached != nil {
+			if raw, ok := se.cached(submission); ok {
+				log.Debug("source not changed", zap.Int("run_id", submission.RunID))
+				submission.Source = raw
+				continue
+			}
+		}
+		raw, contentType, err := se.fetchSource(ctx, submission)
 		if err != nil {
 			return fmt.Errorf("fetch url: %s: %v", submission.sourceHref.String(), err)
 		}
+		submission.Binary = isBinary(contentType, raw)
+		if submission.Binary {
+			log.Warn("binary source",
+				zap.Int("run_id", submission.RunID),
+				zap.String("content_type", contentType),
+				zap.Bool("skip", se.skipBinary),
+			)
+			if se.skipBinary {
+				continue
+			}
+		}
 		submission.Source = raw
+		if se.onSource != nil {
+			if err := se.onSource(submission); err != nil {
+				return err
+			}
+			submission.Source = nil
+		}
 	}
 	return nil
 }
 
-func (se *SubmissionsEmitter) fetchSource(ctx context.Context, u *url.URL) ([]byte, error) {
-	req := &http.Request{
-		Method: http.MethodGet,
-		URL:    u,
+// isBinary reports whether the fetched source is not a text. Declared text types are trusted,
+// other content is sniffed, so sources in legacy encodings like cp1251 are not taken for binary.
+func isBinary(contentType string, raw []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		switch {
+		case strings.HasPrefix(mediaType, "text/"),
+			strings.HasSuffix(mediaType, "+xml"),
+			mediaType == "application/json",
+			mediaType == "application/xml",
+			mediaType == "application/javascript":
+			return false
+		case strings.HasPrefix(mediaType, "image/"),
+			strings.HasPrefix(mediaType, "audio/"),
+			strings.HasPrefix(mediaType, "video/"),
+			mediaType == "application/zip",
+			mediaType == "application/pdf":
+			return true
+		}
+	}
+	// missing, generic (e.g. application/octet-stream) or unknown type
+	if bytes.IndexByte(raw, 0) >= 0 {
+		return true
+	}
+	return !strings.HasPrefix(http.DetectContentType(raw), "text/")
+}
+
+// sourceRequest builds a request opening the source by the view link or by the view form.
+func sourceRequest(ctx context.Context, submission *Submission) (*http.Request, error) {
+	u := *submission.sourceHref
+	if submission.sourceForm == nil {
+		return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	}
+	if submission.sourceMethod != http.MethodPost {
+		u.RawQuery = submission.sourceForm.Encode()
+		return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(submission.sourceForm.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// ErrTruncated is returned if the body of a response is shorter than its Content-Length.
+var ErrTruncated = errors.New("truncated response body")
+
+// fetchSource downloads the source, truncated downloads are repeated up to retries times.
+func (se *SubmissionsEmitter) fetchSource(ctx context.Context, submission *Submission) ([]byte, string, error) {
+	u := submission.sourceHref
+	for attempt := 0; ; attempt++ {
+		raw, contentType, err := se.fetchSourceOnce(ctx, submission)
+		if !errors.Is(err, ErrTruncated) || attempt >= se.retries {
+			return raw, contentType, err
+		}
+		log.Warn("retry source download", zap.Stringer("url", u), zap.Error(err), zap.Int("attempt", attempt+1))
+	}
+}
 
+func (se *SubmissionsEmitter) fetchSourceOnce(ctx context.Context, submission *Submission) ([]byte, string, error) {
+	u := submission.sourceHref
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	req = req.WithContext(cctx)
+	req, err := sourceRequest(cctx, submission)
+	if err != nil {
+		return nil, "", err
+	}
 	resp, err := se.cli.Do(req)
 	if err != nil {
 		log.Error("do request", zap.Error(err), zap.Stringer("url", u))
-		return nil, err
+		return nil, "", err
 	}
 	defer resp.Body.Close()
 
-	return ioutil.ReadAll(resp.Body)
+	var progress ProgressFunc
+	if se.progress != nil {
+		progress = func(read, total int64) { se.progress(u, read, total) }
+	}
+	raw, err := readLimited(resp.Body, resp.ContentLength, se.maxSize, progress)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, "", fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.ContentLength >= 0 && int64(len(raw)) != resp.ContentLength {
+		return nil, "", fmt.Errorf("%w: read %d of %d bytes", ErrTruncated, len(raw), resp.ContentLength)
+	}
+	return raw, resp.Header.Get("Content-Type"), nil
 }
 
 type StandingsEmitter struct {
 	originalHref  *url.URL
+	pdfFont       string
+	team          string
 	StandingsPage string
+	// Solved contains columns marked as solved in the row of the team, nil if the row is not found.
+	Solved []string
 }
 
 func (s *StandingsEmitter) Emit(_ context.Context, doc *goquery.Selection) error {
 	link := doc.Find("link[href]")
 	href, found := link.Attr("href")
 	if found {
-		u, err := s.originalHref.Parse(href)
+		u, err := resolveHref(s.originalHref, href)
 		if err != nil {
 			return fmt.Errorf("change href address: %w", err)
 		}
 		link.SetAttr("href", u.String())
 	}
 	doc.Find(`head > meta[content]`).SetAttr("content", "text/html; charset=utf-8")
+	s.Solved = s.teamSolved(doc)
 	raw, err := doc.Html()
 	s.StandingsPage = raw
 	return err
 }
 
+func (s *StandingsEmitter) teamSolved(doc *goquery.Selection) []string {
+	if s.team == "" {
+		return nil
+	}
+	row := doc.Find(`tr`).FilterFunction(func(_ int, tr *goquery.Selection) bool {
+		return tr.ChildrenFiltered(`td`).FilterFunction(func(_ int, td *goquery.Selection) bool {
+			return strings.TrimSpace(td.Text()) == s.team
+		}).Length() != 0
+	}).First()
+	if row.Length() == 0 {
+		return nil
+	}
+
+	var names, cols []string
+	header, _ := tableRows(row.Closest(`table`))
+	header.Children().Each(eachCol(&names))
+	row.Children().Each(eachCol(&cols))
+
+	solved := []string{}
+	for idx, name := range names {
+		if idx < len(cols) && strings.HasPrefix(strings.TrimSpace(cols[idx]), "+") {
+			solved = append(solved, strings.TrimSpace(name))
+		}
+	}
+	return solved
+}
+
 func (s *StandingsEmitter) GeneratePdf(w io.Writer) error {
-	return GeneratePdf(strings.NewReader(s.StandingsPage), w)
+	return generatePdf(s.StandingsPage, s.pdfFont, w)
 }
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// testDoc parses raw html fixture.
+func testDoc(t *testing.T, raw string) *goquery.Selection {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parse fixture: %v", err)
+	}
+	return doc.Selection
+}
+
+func TestParseTimeMS(t *testing.T) {
+	for _, tc := range []struct {
+		raw      string
+		expected int
+	}{
+		{"", 0},
+		{"120", 120},
+		{"120 ms", 120},
+		{"120msec", 120},
+		{"1.5 s", 1500},
+		{"0,25 sec", 250},
+		{" 2S ", 2000},
+	} {
+		got, err := parseTimeMS(tc.raw)
+		if err != nil {
+			t.Errorf("parseTimeMS(%q): %v", tc.raw, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("parseTimeMS(%q) = %d, expected %d", tc.raw, got, tc.expected)
+		}
+	}
+
+	for _, raw := range []string{"ms", "10 min", "fast"} {
+		if _, err := parseTimeMS(raw); err == nil {
+			t.Errorf("parseTimeMS(%q): expected error", raw)
+		}
+	}
+}
+
+func TestParseMemoryKB(t *testing.T) {
+	for _, tc := range []struct {
+		raw      string
+		expected int
+	}{
+		{"", 0},
+		{"2048", 2048},
+		{"2048 KB", 2048},
+		{"3.5M", 3584},
+		{"64 mb", 65536},
+		{"1G", 1048576},
+		{"10240 b", 10},
+	} {
+		got, err := parseMemoryKB(tc.raw)
+		if err != nil {
+			t.Errorf("parseMemoryKB(%q): %v", tc.raw, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("parseMemoryKB(%q) = %d, expected %d", tc.raw, got, tc.expected)
+		}
+	}
+
+	for _, raw := range []string{"M", "12 pages"} {
+		if _, err := parseMemoryKB(raw); err == nil {
+			t.Errorf("parseMemoryKB(%q): expected error", raw)
+		}
+	}
+}
+
+func TestDecodeSubmissionUsage(t *testing.T) {
+	var se SubmissionsEmitter
+	for _, names := range [][]string{
+		{"Run ID", "Problem", "Result", "Max time", "Max memory"},
+		{"Run ID", "Problem", "Result", "Time used", "Memory used"},
+	} {
+		submission, err := se.decodeSubmission(names, []string{"7", "A", "OK", "0.31 s", "12M"})
+		if err != nil {
+			t.Fatalf("decode %v: %v", names, err)
+		}
+		if submission.MaxTimeMS != 310 || submission.MaxMemoryKB != 12288 {
+			t.Errorf("decode %v: got %d ms, %d KB", names, submission.MaxTimeMS, submission.MaxMemoryKB)
+		}
+	}
+
+	// usage of compilation errors is not known, the row is still decoded
+	for _, raw := range []string{"N/A", "-", "slow"} {
+		submission, err := se.decodeSubmission([]string{"Run ID", "Max time", "Max memory"}, []string{"7", raw, raw})
+		if err != nil {
+			t.Errorf("decode %q: %v", raw, err)
+			continue
+		}
+		if submission.RunID != 7 || submission.MaxTimeMS != 0 || submission.MaxMemoryKB != 0 {
+			t.Errorf("decode %q: got run %d, %d ms, %d KB", raw, submission.RunID, submission.MaxTimeMS, submission.MaxMemoryKB)
+		}
+	}
+}
+
+func TestDecodeSubmissionRunID(t *testing.T) {
+	var se SubmissionsEmitter
+	for raw, expected := range map[string]int{
+		"12":                   12,
+		" 12* ":                12,
+		"#12 (rejudged)":       12,
+		"":                     0,
+		"-":                    0,
+		"99999999999999999999": 0,
+	} {
+		submission, err := se.decodeSubmission([]string{"Run ID", "Problem"}, []string{raw, "A"})
+		if err != nil {
+			t.Errorf("decode %q: %v", raw, err)
+			continue
+		}
+		if submission.RunID != expected || submission.ProblemID != "A" {
+			t.Errorf("decode %q: got run %d of problem %q", raw, submission.RunID, submission.ProblemID)
+		}
+	}
+}
+
+func TestParseTestsFraction(t *testing.T) {
+	tests := []struct {
+		raw           string
+		passed, total int
+	}{
+		{raw: "Partial solution 12/30", passed: 12, total: 30},
+		{raw: "Partial solution 0 / 30", passed: 0, total: 30},
+		{raw: "OK"},
+		{raw: "Wrong answer, test 3"},
+		{raw: "Partial solution 31/30"},
+	}
+	for _, tt := range tests {
+		if passed, total := parseTestsFraction(tt.raw); passed != tt.passed || total != tt.total {
+			t.Errorf("parseTestsFraction(%q) = %d/%d, expected %d/%d", tt.raw, passed, total, tt.passed, tt.total)
+		}
+	}
+
+	var se SubmissionsEmitter
+	submission, err := se.decodeSubmission([]string{"Run ID", "Problem", "Result"}, []string{"7", "A", "Partial solution 12/30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submission.TestsPassed != 12 || submission.TestsTotal != 30 {
+		t.Errorf("decode: got %d/%d tests", submission.TestsPassed, submission.TestsTotal)
+	}
+}
+
+func TestLoginFormEmitter(t *testing.T) {
+	base, _ := url.Parse("https://contest.example/cgi-bin/new-client?contest_id=1")
+	doc := testDoc(t, `<html><body>
+<form action="/search"><input type="text" name="q"></form>
+<form action="/cgi-bin/new-client" method="post">
+<input type="hidden" name="csrf" value="token">
+<input type="text" name="user"><input type="password" name="pass">
+</form></body></html>`)
+
+	form := &LoginFormEmitter{originalHref: base}
+	if err := form.Emit(context.Background(), doc); err != nil {
+		t.Fatal(err)
+	}
+	if form.LoginField != "user" || form.PasswordField != "pass" {
+		t.Errorf("got fields %q, %q", form.LoginField, form.PasswordField)
+	}
+	if form.Method != http.MethodPost || form.Action.String() != "https://contest.example/cgi-bin/new-client" {
+		t.Errorf("got %s %s", form.Method, form.Action)
+	}
+
+	if err := form.Emit(context.Background(), testDoc(t, `<form><input name="q"></form>`)); err == nil {
+		t.Error("expected error without password input")
+	}
+}
+
+// summaryPage is a problems summary with tags.
+const summaryPage = `<html><head><link rel="stylesheet" href="/style.css"></head><body>
+<h2>Problem summary</h2>
+<table class="b1">
+<tr><th>Short name</th><th>Long name</th><th>Tags</th><th>Status</th><th>Run ID</th></tr>
+<tr><td><a href="/statement?prob_id=1">A</a></td><td>Sum</td><td>math, implementation</td><td>OK</td><td>3</td></tr>
+<tr><td><a href="/statement?prob_id=2">B</a></td><td>Graph</td><td> </td><td>Wrong answer</td><td>2</td></tr>
+</table></body></html>`
+
+func TestProblemTags(t *testing.T) {
+	base, _ := url.Parse("http://contest.example/summary")
+	pe := &ProblemsEmitter{originalHref: base}
+	if err := pe.Emit(context.Background(), testDoc(t, summaryPage)); err != nil {
+		t.Fatal(err)
+	}
+	if len(pe.Problems) != 2 {
+		t.Fatalf("got %d problems", len(pe.Problems))
+	}
+	if tags := pe.Problems[0].Tags; !reflect.DeepEqual(tags, []string{"math", "implementation"}) {
+		t.Errorf("got tags %q", tags)
+	}
+	if tags := pe.Problems[1].Tags; tags != nil {
+		t.Errorf("empty cell: got tags %q", tags)
+	}
+}
+
+func TestStatementSamples(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		raw      string
+		expected []SampleTest
+	}{
+		{
+			name: "table",
+			raw: `<h3>Examples</h3><table><tr><th>Input</th><th>Output</th></tr>
+<tr><td><pre>1 2</pre></td><td><pre>3</pre></td></tr></table>`,
+			expected: []SampleTest{{Input: "1 2", Output: "3"}},
+		},
+		{
+			name: "headings",
+			raw: `<h3>Legend</h3><pre>int main() {}</pre>
+<h3>Example</h3><h4>Input</h4><pre>1 2</pre><h4>Output</h4><pre>3</pre>
+<h3>Note</h3><pre>explanation</pre>`,
+			expected: []SampleTest{{Input: "1 2", Output: "3"}},
+		},
+		{
+			name:     "russian headings",
+			raw:      `<pre>код из условия</pre><h3>Пример</h3><pre>5</pre><pre>25</pre>`,
+			expected: []SampleTest{{Input: "5", Output: "25"}},
+		},
+		{
+			name: "no headings",
+			raw:  `<pre>a</pre><pre>b</pre>`,
+		},
+		{
+			name: "odd",
+			raw:  `<h3>Example</h3><pre>1 2</pre>`,
+		},
+	} {
+		problem := &Problem{ID: "A"}
+		st := &StatementEmitter{Problem: problem}
+		if err := st.Emit(context.Background(), testDoc(t, `<html><body>`+tc.raw+`</body></html>`)); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(problem.Samples, tc.expected) {
+			t.Errorf("%s: got %+v, expected %+v", tc.name, problem.Samples, tc.expected)
+		}
+		if problem.Statement == "" {
+			t.Errorf("%s: statement not kept", tc.name)
+		}
+	}
+}
+
+func TestTableRows(t *testing.T) {
+	for name, raw := range map[string]string{
+		"no tbody": `<table class="b1"><tr><th>Run ID</th><th>Problem</th></tr>
+<tr><td>2</td><td>B</td></tr><tr><td>1</td><td>A</td></tr></table>`,
+		"thead": `<table class="b1"><thead><tr><th>Run ID</th><th>Problem</th></tr></thead>
+<tbody><tr><td>2</td><td>B</td></tr><tr><td>1</td><td>A</td></tr></tbody></table>`,
+		"td header": `<table class="b1"><tr><td>Run ID</td><td>Problem</td></tr>
+<tr><td>2</td><td>B</td></tr><tr><td>1</td><td>A</td></tr></table>`,
+		"nested": `<table class="b1"><tr><th>Run ID</th><th>Problem</th></tr>
+<tr><td>2</td><td><table><tr><td>B</td></tr></table></td></tr><tr><td>1</td><td>A</td></tr></table>`,
+	} {
+		header, rows := tableRows(findTable(testDoc(t, raw), "Submissions"))
+		var names []string
+		header.Children().Each(eachCol(&names))
+		if !reflect.DeepEqual(names, []string{"Run ID", "Problem"}) {
+			t.Errorf("%s: got header %q", name, names)
+		}
+		if rows.Length() != 2 {
+			t.Errorf("%s: got %d rows, expected 2", name, rows.Length())
+		}
+	}
+}
+
+func TestSubmissionsParams(t *testing.T) {
+	base, _ := url.Parse("http://contest.example/contest")
+	for _, tc := range []struct {
+		allRuns  bool
+		params   url.Values
+		expected url.Values
+	}{
+		{false, nil, url.Values{"SID": {"1"}}},
+		{true, nil, url.Values{"SID": {"1"}, "all_runs": {"1"}}},
+		{true, url.Values{"all_runs": {"0"}, "page": {"2"}}, url.Values{"SID": {"1"}, "all_runs": {"0"}, "page": {"2"}}},
+	} {
+		h := &HrefEmitter{originalHref: base, allRuns: tc.allRuns, submissionsParams: tc.params}
+		if err := h.Emit(context.Background(), testDoc(t, selfTestMenu)); err != nil {
+			t.Fatal(err)
+		}
+		if got := h.SubmissionsHref.Query(); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("all_runs=%v, params %v: got %v, expected %v", tc.allRuns, tc.params, got, tc.expected)
+		}
+	}
+}
+
+func TestFindTableOnSharedPage(t *testing.T) {
+	doc := testDoc(t, `<html><head><link rel="stylesheet" href="/style.css"></head><body>
+<h2>Submissions</h2>
+<table class="b1"><tr><th>Run ID</th><th>Problem</th></tr><tr><td>1</td><td>A</td></tr></table>
+<table class="b1"><caption>Problem summary</caption>
+<tr><th>Short name</th><th>Long name</th><th>Status</th><th>Run ID</th></tr>
+<tr><td>A</td><td>Sum</td><td>OK</td><td>1</td></tr></table>
+</body></html>`)
+
+	if got := findTable(doc, "Submissions", "Runs").Find(`th`).First().Text(); got != "Run ID" {
+		t.Errorf("submissions table: got first column %q", got)
+	}
+	if got := findTable(doc, "Summary", "Problems").Find(`th`).First().Text(); got != "Short name" {
+		t.Errorf("summary table: got first column %q", got)
+	}
+
+	base, _ := url.Parse("http://contest.example/summary")
+	pe := &ProblemsEmitter{originalHref: base}
+	if err := pe.Emit(context.Background(), doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(pe.Problems) != 1 || pe.Problems[0].ID != "A" || !pe.Problems[0].OK {
+		t.Errorf("unexpected problems %+v", pe.Problems)
+	}
+}
+
+func TestDecodeProblemRunID(t *testing.T) {
+	names := []string{"Short name", "Status", "Run ID"}
+	var pe ProblemsEmitter
+	for _, tc := range []struct {
+		cols     []string
+		expected int
+	}{
+		{[]string{"A", "OK", "42"}, 42},
+		{[]string{"A", "OK", ""}, 0},
+		{[]string{"A", "OK", "#42 (view)"}, 42},
+		{[]string{"A", "OK", "N/A"}, 0},
+		{[]string{"A", "Wrong answer", "garbage"}, 0},
+	} {
+		problem, err := pe.decodeProblem(names, tc.cols)
+		if err != nil {
+			t.Errorf("%q: %v", tc.cols, err)
+			continue
+		}
+		if problem.RunID != tc.expected {
+			t.Errorf("%q: got run id %d, expected %d", tc.cols, problem.RunID, tc.expected)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	cp1251 := []byte("// \xcf\xf0\xe8\xe2\xe5\xf2\nint main() {}\n")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		raw         []byte
+		expected    bool
+	}{
+		{"utf-8 text", "text/plain; charset=utf-8", []byte("int main() {}\n"), false},
+		{"cp1251 text", "text/plain; charset=windows-1251", cp1251, false},
+		{"cp1251 without type", "", cp1251, false},
+		{"cp1251 octet-stream", "application/octet-stream", cp1251, false},
+		{"declared text with nul", "text/plain", []byte("a\x00b"), false},
+		{"nul without type", "", []byte("a\x00b"), true},
+		{"png", "image/png", png, true},
+		{"png octet-stream", "application/octet-stream", png, true},
+		{"zip", "application/zip", []byte("PK\x03\x04"), true},
+		{"elf", "", []byte("\x7fELF\x02\x01\x01\x00"), true},
+	} {
+		if got := isBinary(tc.contentType, tc.raw); got != tc.expected {
+			t.Errorf("%s: got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestSkipBinarySource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	for _, skip := range []bool{false, true} {
+		se := &SubmissionsEmitter{cli: srv.Client(), maxSize: 1 << 20, skipBinary: skip}
+		submission := &Submission{RunID: 1, sourceHref: u}
+		if err := se.loadSource(context.Background(), []*Submission{submission}); err != nil {
+			t.Fatal(err)
+		}
+		if !submission.Binary {
+			t.Errorf("skip=%v: source not detected as binary", skip)
+		}
+		if (submission.Source == nil) != skip {
+			t.Errorf("skip=%v: got source %q", skip, submission.Source)
+		}
+	}
+}
+
+func TestResolveHref(t *testing.T) {
+	for _, tc := range []struct {
+		base, href, expected string
+	}{
+		{"https://h/contest", "/summary", "https://h/summary"},
+		{"https://h/contest", "http://h/summary", "https://h/summary"},
+		{"http://h/contest", "https://h/summary", "https://h/summary"},
+		{"http://h/contest", "http://h/summary", "http://h/summary"},
+		{"https://h/contest", "http://mirror/summary", "http://mirror/summary"},
+		{"http://h/contest", "https://mirror/summary", "https://mirror/summary"},
+		{"https://h/contest", "ftp://h/statement.pdf", "ftp://h/statement.pdf"},
+	} {
+		base, _ := url.Parse(tc.base)
+		u, err := resolveHref(base, tc.href)
+		if err != nil {
+			t.Errorf("resolveHref(%s, %s): %v", tc.base, tc.href, err)
+			continue
+		}
+		if u.String() != tc.expected {
+			t.Errorf("resolveHref(%s, %s) = %s, expected %s", tc.base, tc.href, u, tc.expected)
+		}
+	}
+}
+
+func TestPdfPage(t *testing.T) {
+	raw := `<html><head><meta http-equiv="Content-Type" content="text/html; charset=koi8-r"><title>Таблица</title></head>
+<body><table><tr><td>Задача</td></tr></table></body></html>`
+	page, err := pdfPage(raw, `"DejaVu Sans"; } body { color: red`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := testDoc(t, page)
+	if charset, _ := doc.Find(`head > meta`).First().Attr("charset"); charset != "utf-8" || doc.Find(`meta[http-equiv]`).Length() != 0 {
+		t.Errorf("charset is not replaced: %s", page)
+	}
+	style := doc.Find(`head > style`).Text()
+	if style != `body, table { font-family: "DejaVu Sans"  body  color: red; }` {
+		t.Errorf("got style %q", style)
+	}
+	if !strings.Contains(doc.Find(`td`).Text(), "Задача") {
+		t.Errorf("text is lost: %s", page)
+	}
+
+	page, err = pdfPage(raw, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testDoc(t, page).Find(`style`).Length() != 0 {
+		t.Error("style added without font")
+	}
+}
+
+func TestContestState(t *testing.T) {
+	base, _ := url.Parse("http://contest.example/contest")
+	for _, tc := range []struct {
+		name     string
+		raw      string
+		expected error
+	}{
+		{"running", selfTestMenu, nil},
+		{"not started", `<p>Contest is not started</p>`, ErrContestNotStarted},
+		{"not started russian", `<p>Соревнование ещё не началось</p>` + selfTestMenu, ErrContestNotStarted},
+		{"finished", `<p>Contest is over</p>`, ErrContestFinished},
+		{"upsolving", `<p>Contest is over</p>` + selfTestMenu, nil},
+	} {
+		h := &HrefEmitter{originalHref: base}
+		err := h.Emit(context.Background(), testDoc(t, tc.raw))
+		if tc.expected == nil && err != nil || tc.expected != nil && !errors.Is(err, tc.expected) {
+			t.Errorf("%s: got %v, expected %v", tc.name, err, tc.expected)
+		}
+	}
+}
+
+func TestPageContestID(t *testing.T) {
+	for _, tc := range []struct {
+		base, raw string
+		id        int
+		found     bool
+	}{
+		{"http://h/team.cgi", `<input type="hidden" name="contest_id" value=" 7 ">`, 7, true},
+		{"http://h/team.cgi", `<a href="/logout">Logout</a><a href="/team.cgi?contest_id=8&amp;action=2">Standings</a>`, 8, true},
+		{"http://h/team.cgi?contest_id=9", `<p>no id</p>`, 9, true},
+		{"http://h/team.cgi", `<p>no id</p>`, 0, false},
+	} {
+		base, _ := url.Parse(tc.base)
+		id, found := pageContestID(base, testDoc(t, tc.raw))
+		if id != tc.id || found != tc.found {
+			t.Errorf("%s %s: got %d, %v, expected %d, %v", tc.base, tc.raw, id, found, tc.id, tc.found)
+		}
+	}
+}
+
+func TestContestTitle(t *testing.T) {
+	for raw, expected := range map[string]string{
+		`<head><title>Open Cup 2020 - ejudge</title></head>`:                                                                "Open Cup 2020",
+		`<head><title>Кубок  Урала — EJUDGE</title></head>`:                                                                 "Кубок Урала",
+		`<head><title>ejudge</title></head>`:                                                                                "ejudge",
+		`<head><title>Team page</title></head><ul class="breadcrumb"><li>Home</li><li> Stage 3: Moscow </li><li></li></ul>`: "Stage 3: Moscow",
+		`<div class="breadcrumbs"><a href="/">Home</a> / <a href="/c">Grand Prix | ejudge</a></div>`:                        "Grand Prix",
+		`<p>no title</p>`: "",
+	} {
+		if got := contestTitle(testDoc(t, raw)); got != expected {
+			t.Errorf("contestTitle(%s) = %q, expected %q", raw, got, expected)
+		}
+	}
+}
+
+func TestSkipBadRows(t *testing.T) {
+	page := `<html><head><link rel="stylesheet" href="/style.css"></head><body>
+<table class="b1">
+<tr><th>Short name</th><th>Long name</th><th>Status</th><th>Run ID</th></tr>
+<tr><td>A</td><td>Sum</td><td>OK</td><td>3</td></tr>
+<tr><td colspan="4">Problems below are added during the contest</td></tr>
+<tr><td>B</td><td>Graph</td><td>OK</td><td>99999999999999999999</td></tr>
+<tr><td>C</td><td>Strings</td><td>Wrong answer</td><td></td></tr>
+</table></body></html>`
+	base, _ := url.Parse("http://contest.example/summary")
+
+	pe := &ProblemsEmitter{originalHref: base}
+	if err := pe.Emit(context.Background(), testDoc(t, page)); err == nil {
+		t.Error("expected error on bad row")
+	}
+
+	pe = &ProblemsEmitter{originalHref: base, skipBadRows: true}
+	if err := pe.Emit(context.Background(), testDoc(t, page)); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, problem := range pe.Problems {
+		ids = append(ids, problem.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"A", "C"}) {
+		t.Errorf("got problems %q", ids)
+	}
+	if len(pe.BadRows) != 2 || !strings.HasPrefix(pe.BadRows[0].Error(), "row 2:") || !strings.HasPrefix(pe.BadRows[1].Error(), "row 3:") {
+		t.Errorf("got bad rows %v", pe.BadRows)
+	}
+}
+
+func TestProblemNameEntities(t *testing.T) {
+	page := `<html><head><link rel="stylesheet" href="/style.css"></head><body>
+<table class="b1">
+<tr><th>Short name</th><th>Long name</th><th>Status</th><th>Run ID</th></tr>
+<tr><td><a href="/statement?prob_id=1"><b>A&amp;B</b></a></td><td>A &lt; B&nbsp;</td><td>OK</td><td>3</td></tr>
+<tr><td>B</td><td>Print &amp;lt;b&amp;gt; tag</td><td>OK</td><td>5</td></tr>
+<tr><td>C<sub>1</sub></td><td>&quot;Tom&quot; <i>&amp;</i> Jerry</td><td>OK</td><td>4</td></tr>
+</table></body></html>`
+	base, _ := url.Parse("http://contest.example/summary")
+	pe := &ProblemsEmitter{originalHref: base}
+	if err := pe.Emit(context.Background(), testDoc(t, page)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, problem := range pe.Problems {
+		got = append(got, problem.ID+":"+problem.Name)
+	}
+	// "&lt;" shown on the page must not be decoded again
+	expected := []string{"A&B:A < B", "B:Print &lt;b&gt; tag", `C1:"Tom" & Jerry`}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got problems %q, expected %q", got, expected)
+	}
+}
+
+func TestFetchSourceTruncated(t *testing.T) {
+	const source = "int main() { return 0; }"
+	var requests, short int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > atomic.LoadInt32(&short) {
+			w.Write([]byte(source))
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s", len(source), source[:10])
+		buf.Flush()
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	tests := []struct {
+		name    string
+		short   int32
+		retries int
+		wantErr bool
+	}{
+		{name: "complete", short: 0, retries: 2},
+		{name: "retried", short: 2, retries: 2},
+		{name: "exhausted", short: 3, retries: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			atomic.StoreInt32(&short, tt.short)
+			se := &SubmissionsEmitter{cli: srv.Client(), maxSize: 1 << 20, retries: tt.retries}
+			raw, _, err := se.fetchSource(context.Background(), &Submission{RunID: 1, sourceHref: u})
+			if tt.wantErr {
+				if !errors.Is(err, ErrTruncated) {
+					t.Fatalf("got error %v, want %v", err, ErrTruncated)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(raw) != source {
+					t.Errorf("got source %q", raw)
+				}
+			}
+			want := tt.short + 1
+			if tt.wantErr {
+				want = int32(tt.retries) + 1
+			}
+			if got := atomic.LoadInt32(&requests); got != want {
+				t.Errorf("got %d requests, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestViewFormSource(t *testing.T) {
+	page := `<html><body>
+<h2>Submissions</h2>
+<table class="b1">
+<tr><th>Run ID</th><th>Time</th><th>Problem</th><th>Language</th><th>Result</th><th>View source</th></tr>
+<tr><td>2</td><td>00:20:00</td><td>B</td><td>python3</td><td>OK</td><td><form action="/view" method="post">
+<input type="hidden" name="run_id" value="2"><input type="hidden" name="SID" value="1">
+<input type="submit" name="action_91" value="View"></form></td></tr>
+<tr><td>1</td><td>00:10:00</td><td>A</td><td>g++</td><td>OK</td><td><form action="/view">
+<input type="hidden" name="run_id" value="1"><button>View</button></form></td></tr>
+</table></body></html>`
+	methods := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/submissions" {
+			w.Write([]byte(page))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		runID := r.Form.Get("run_id")
+		if r.Method == http.MethodPost && (r.PostForm.Get("SID") != "1" || r.PostForm.Get("action_91") != "View") {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		methods[runID] = r.Method
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(selfTestSources[runID]))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	u, _ := url.Parse(srv.URL + "/submissions")
+	p.InitEmitters(u)
+	if err := p.Do(context.Background(), u, &p.SubmissionsEmitter); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, submission := range p.Submissions {
+		got = append(got, fmt.Sprintf("%d:%s", submission.RunID, submission.Source))
+	}
+	expected := []string{"2:" + selfTestSources["2"], "1:" + selfTestSources["1"]}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+	if expected := map[string]string{"1": http.MethodGet, "2": http.MethodPost}; !reflect.DeepEqual(methods, expected) {
+		t.Errorf("got methods %v, expected %v", methods, expected)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "sort"
+
+// SubmissionEvent is a submission of a problem in the history.
+type SubmissionEvent struct {
+	RunID  int
+	Time   string
+	Result string
+	OK     bool
+	// VerdictChanged is set if the result differs from the previous submission of the problem.
+	VerdictChanged bool
+}
+
+// setSolvedLanguages collects languages of accepted runs of every problem.
+func setSolvedLanguages(problems []*Problem, runs []*Submission) {
+	languages := make(map[string]map[string]bool)
+	for _, run := range runs {
+		if !run.OK {
+			continue
+		}
+		if languages[run.ProblemID] == nil {
+			languages[run.ProblemID] = make(map[string]bool)
+		}
+		languages[run.ProblemID][run.Language] = true
+	}
+
+	for _, problem := range problems {
+		problem.SolvedLanguages = nil
+		for lang := range languages[problem.ID] {
+			problem.SolvedLanguages = append(problem.SolvedLanguages, lang)
+		}
+		sort.Strings(problem.SolvedLanguages)
+	}
+}
+
+// History returns every run grouped by problem in chronological order.
+func History(runs []*Submission) map[string][]SubmissionEvent {
+	ordered := make([]*Submission, len(runs))
+	copy(ordered, runs)
+	// run ids grow with submit time
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].RunID < ordered[j].RunID
+	})
+
+	history := make(map[string][]SubmissionEvent)
+	for _, run := range ordered {
+		events := history[run.ProblemID]
+		history[run.ProblemID] = append(events, SubmissionEvent{
+			RunID:          run.RunID,
+			Time:           run.Time,
+			Result:         run.Result,
+			OK:             run.OK,
+			VerdictChanged: len(events) != 0 && events[len(events)-1].Result != run.Result,
+		})
+	}
+	return history
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	// runs are listed newest first as in the submissions table
+	runs := []*Submission{
+		{RunID: 4, ProblemID: "A", Time: "00:40:00", Result: "OK", OK: true},
+		{RunID: 3, ProblemID: "B", Time: "00:30:00", Result: "Wrong answer"},
+		{RunID: 2, ProblemID: "A", Time: "00:20:00", Result: "Wrong answer"},
+		{RunID: 1, ProblemID: "A", Time: "00:10:00", Result: "Wrong answer"},
+	}
+	expected := map[string][]SubmissionEvent{
+		"A": {
+			{RunID: 1, Time: "00:10:00", Result: "Wrong answer"},
+			{RunID: 2, Time: "00:20:00", Result: "Wrong answer"},
+			{RunID: 4, Time: "00:40:00", Result: "OK", OK: true, VerdictChanged: true},
+		},
+		"B": {
+			{RunID: 3, Time: "00:30:00", Result: "Wrong answer"},
+		},
+	}
+	if got := History(runs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+	if runs[0].RunID != 4 {
+		t.Error("runs are reordered in place")
+	}
+
+	stubPdf(t)
+	p := &Parser{WriteHistory: true}
+	p.Runs = runs
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		History map[string][]SubmissionEvent
+	}
+	if err := json.Unmarshal(sink["history.json"], &written); err != nil {
+		t.Fatalf("decode history.json: %v", err)
+	}
+	if !reflect.DeepEqual(written.History, expected) {
+		t.Errorf("history.json: got %+v", written.History)
+	}
+}
+
+func TestSetSolvedLanguages(t *testing.T) {
+	problems := []*Problem{{ID: "A"}, {ID: "B", SolvedLanguages: []string{"stale"}}}
+	runs := []*Submission{
+		{RunID: 5, ProblemID: "A", Language: "python3", OK: true},
+		{RunID: 4, ProblemID: "A", Language: "g++", OK: true},
+		{RunID: 3, ProblemID: "A", Language: "g++", OK: true},
+		{RunID: 2, ProblemID: "A", Language: "fpc"},
+		{RunID: 1, ProblemID: "B", Language: "g++"},
+	}
+	setSolvedLanguages(problems, runs)
+	if expected := []string{"g++", "python3"}; !reflect.DeepEqual(problems[0].SolvedLanguages, expected) {
+		t.Errorf("A: got %q, expected %q", problems[0].SolvedLanguages, expected)
+	}
+	if problems[1].SolvedLanguages != nil {
+		t.Errorf("B: got %q", problems[1].SolvedLanguages)
+	}
+}
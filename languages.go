@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// defaultLanguages maps ejudge compiler ids of the default installation to short names.
+var defaultLanguages = map[string]string{
+	"1":  "fpc",
+	"2":  "gcc",
+	"3":  "g++",
+	"23": "python3",
+}
+
+// loadLanguages merges the default mapping with the json object from path, if any.
+func loadLanguages(path string) (map[string]string, error) {
+	languages := make(map[string]string, len(defaultLanguages))
+	for id, name := range defaultLanguages {
+		languages[id] = name
+	}
+	if path == "" {
+		return languages, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom := make(map[string]string)
+	if err := json.Unmarshal(raw, &custom); err != nil {
+		return nil, fmt.Errorf("decode language map: %q: %w", path, err)
+	}
+	for id, name := range custom {
+		languages[id] = name
+	}
+	return languages, nil
+}
+
+// resolveLanguage returns canonical name for the language id, unknown values are returned as is.
+func resolveLanguage(languages map[string]string, raw string) string {
+	if name, ok := languages[strings.TrimSpace(raw)]; ok {
+		return name
+	}
+	return raw
+}
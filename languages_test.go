@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLanguages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "languages.json")
+	if err := ioutil.WriteFile(path, []byte(`{"3": "g++17", "64": "kotlin"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	languages, err := loadLanguages(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for raw, expected := range map[string]string{
+		"2":    "gcc",
+		" 3 ":  "g++17",
+		"64":   "kotlin",
+		"rust": "rust",
+	} {
+		if got := resolveLanguage(languages, raw); got != expected {
+			t.Errorf("resolveLanguage(%q) = %q, expected %q", raw, got, expected)
+		}
+	}
+	if defaultLanguages["3"] != "g++" {
+		t.Error("custom mapping changed the defaults")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`["g++"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadLanguages(path); err == nil {
+		t.Error("expected error on malformed mapping")
+	}
+}
+
+func TestDecodeSubmissionLanguage(t *testing.T) {
+	se := &SubmissionsEmitter{languages: defaultLanguages}
+	submission, err := se.decodeSubmission([]string{"Run ID", "Language"}, []string{"1", "23"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if submission.Language != "python3" || submission.RawLanguage != "23" {
+		t.Errorf("got %q (raw %q)", submission.Language, submission.RawLanguage)
+	}
+}
+
+func TestWritePascalSource(t *testing.T) {
+	se := &SubmissionsEmitter{languages: defaultLanguages}
+	submission, err := se.decodeSubmission([]string{"Run ID", "Problem", "Language"}, []string{"5", "A", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submission.Source = []byte("begin end.")
+	if err := setSourcePaths(mustSourceName(t, defaultSourceName), []*Submission{submission}); err != nil {
+		t.Fatal(err)
+	}
+
+	stubPdf(t)
+	p := &Parser{}
+	p.Problems = []*Problem{{ID: "A"}}
+	p.Submissions = []*Submission{submission}
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(sink[filepath.Join("A", "main.pas")]); got != "begin end." {
+		t.Errorf("got source %q, files %q", got, names(sink))
+	}
+}
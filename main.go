@@ -1,22 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 
 	"github.com/PuerkitoBio/goquery"
@@ -27,21 +33,99 @@ var (
 	log, _ = lc.Build()
 )
 
+const (
+	exitError      = 1
+	exitWriteError = 2
+)
+
 func main() {
 	var p Parser
 
 	flag.StringVar(&p.Username, "username", "msknord13", "")
 	flag.StringVar(&p.Password, "password", "", "required")
+	flag.StringVar(&p.LoginField, "login-field", "", "login form field for username (auto-detected if empty)")
+	flag.StringVar(&p.PasswordField, "password-field", "", "login form field for password (auto-detected if empty)")
 	flag.IntVar(&p.ContestID, "contest-id", 10521, "context id (10521, 10523, ...)")
 	flag.StringVar(&p.BaseURL, "url", "http://opentrains.snarknews.info/~ejudge/team.cgi", "path to contest site")
-	flag.StringVar(&p.Output, "o", "contests", "path to output dir")
+	flag.Var(&p.Outputs, "o", "path to output dir, optionally followed by \",format=dir\" (repeatable, default \"contests\")")
 	flag.BoolVar(&p.Force, "force", false, "overwrite output dir")
+	flag.BoolVar(&p.ForceHTTP1, "force-http1", false, "disable HTTP/2 negotiation")
+	flag.StringVar(&p.MinTLSVersion, "strict-tls-version", "1.2", "minimum TLS version (1.0, 1.1, 1.2, 1.3)")
+	flag.DurationVar(&p.DialTimeout, "dial-timeout", 3*time.Second, "timeout of establishing connection")
+	flag.IntVar(&p.Retries, "retries", 2, "number of retries of failed requests, forms submitted with POST are not retried")
+	flag.StringVar(&p.RetryOn, "retry-on", defaultRetryOn, "comma separated status codes and network errors (timeout, reset) to retry on")
+	flag.DurationVar(&p.ResponseHeaderTimeout, "response-header-timeout", 5*time.Second, "timeout of waiting for response headers after request is sent")
+	flag.BoolVar(&p.Incremental, "incremental", false, "reuse output dir and fetch only sources changed since previous run")
+	flag.BoolVar(&p.Statements, "statements", false, "fetch problem statements and extract sample tests")
+	flag.BoolVar(&p.Polygon, "polygon", false, "export problems as Polygon packages (implies -statements)")
+	flag.BoolVar(&p.AllRuns, "all-runs", true, "scrape all runs instead of own latest runs")
+	flag.Var(&p.SubmissionsParams, "submissions-param", "extra key=value query parameter of submissions url (repeatable)")
+	flag.StringVar(&p.TeamName, "team-name", "", "name of the team in standings for cross-checking solved problems (default is username)")
+	flag.StringVar(&p.RunIDsFile, "run-ids-file", "", "path to file with run ids (one per line) to fetch instead of latest run of each problem")
+	flag.Int64Var(&p.MaxSize, "max-size", 16<<20, "max size of downloaded file in bytes, 0 disables the check")
+	flag.BoolVar(&p.IncludeDiffs, "include-diffs", false, "fetch all attempts and write their diffs against the final accepted source")
+	flag.BoolVar(&p.IncludeHeaders, "include-headers", false, "write parsed table headers to headers.json in output dir")
+	flag.BoolVar(&p.SkipBinary, "skip-binary", false, "do not write sources detected as binary")
+	flag.BoolVar(&p.DeltaOnly, "delta-only", false, "write only problems and submissions changed since previous state to delta.json")
+	flag.StringVar(&p.SSO.URL, "sso-url", "", "url of SSO login form to submit before contest login")
+	flag.StringVar(&p.SSO.Username, "sso-username", "", "SSO username (default is username)")
+	flag.StringVar(&p.SSO.Password, "sso-password", "", "SSO password (default is password)")
+	flag.StringVar(&p.SSO.UsernameField, "sso-username-field", "username", "SSO form field for username")
+	flag.StringVar(&p.SSO.PasswordField, "sso-password-field", "password", "SSO form field for password")
+	flag.BoolVar(&p.IncludeRaw, "include-raw", false, "write raw html of parsed tables to output dir")
+	flag.BoolVar(&p.ResolveLanguages, "resolve-languages", false, "map ejudge compiler ids to language names")
+	flag.StringVar(&p.LanguageMap, "language-map", "", "path to json object with additional compiler id to language name mapping")
+	flag.Float64Var(&p.SimilarityThreshold, "similarity-threshold", 0, "write pairs of submissions with sources similar above threshold to similar.json (0..1, 0 disables)")
+	flag.BoolVar(&p.PrintSelectors, "print-selectors-used", false, "log which table column each parsed field is taken from and write it to selectors.json")
+	flag.BoolVar(&p.WriteHistory, "history", false, "write history of all submissions of each problem to history.json")
+	flag.BoolVar(&p.VerifyCompile, "verify-compile", false, "check that sources compile with locally available compilers and write results to compile.json (compilers run unsandboxed, only with a timeout)")
+	flag.StringVar(&p.PdfFont, "pdf-font", "\"DejaVu Sans\", Arial, sans-serif", "css font-family of generated pdf files")
+	flag.BoolVar(&p.OwnRunsOnly, "own-runs-only", false, "filter submissions by the logged in user regardless of role")
+	flag.StringVar(&p.SourceName, "source-name", "", "go template of source path with fields ProblemID, RunID, Language, Ext, Verdict (default \""+defaultSourceName+"\")")
+	flag.BoolVar(&p.RunsCSV, "runs-csv", false, "write all runs to runs.csv in output dir")
+	flag.StringVar(&p.RunsCSVColumns, "runs-csv-columns", defaultRunColumns, "comma separated columns of runs.csv, "+optionalRunColumns+" are also available")
+	flag.BoolVar(&p.ProbePath, "probe-path", false, "try known variants of url path if it responds with 404")
+	flag.StringVar(&p.Format, "format", "", "format of additional report.md in output dir (md)")
+	flag.BoolVar(&p.StreamSources, "stream-sources", false, "write sources to output dirs as soon as they are fetched instead of keeping them in memory")
+	flag.StringVar(&p.Verify, "verify", "", "compare scraped data with state.json snapshot instead of writing output, fail on mismatch")
+	flag.BoolVar(&p.SkipBadRows, "skip-bad-rows", false, "skip problems table rows which can not be decoded instead of failing")
+	flag.StringVar(&p.Roles, "roles", "", "comma separated ejudge roles to scrape one by one into role-N subdirectories of outputs (e.g. 0,6)")
+	flag.StringVar(&p.RenameFields, "rename-fields", "", "path to json object mapping struct field names of written json files (except state.json and manifest.json) to new names, map keys are kept")
+	flag.StringVar(&p.Problem, "problem", "", "short name of the only problem to fetch submissions of")
+	selfTest := flag.Bool("selftest", false, "scrape the bundled synthetic contest without network and report PASS or FAIL")
+	flag.BoolVar(&p.Preflight, "preflight", false, "check that all contest pages are reachable before fetching them")
+	flag.Var(&p.Cookies, "cookie", "name=value of cookie sent to contest site, e.g. session exported from browser (repeatable)")
+	flag.StringVar(&p.CookieFile, "cookie-file", "", "path to cookies file in Netscape format")
+	flag.BoolVar(&p.SkipLogin, "skip-login", false, "use session of -cookie or -cookie-file without logging in, -url must be the contest page")
 	flag.Parse()
 
-	p.cli = &http.Client{
-		Transport: http.DefaultTransport,
-		Timeout:   5 * time.Second,
+	if *selfTest {
+		if err := SelfTest(context.Background()); err != nil {
+			fmt.Println("FAIL:", err)
+			os.Exit(exitError)
+		}
+		fmt.Println("PASS")
+		return
+	}
+
+	if len(p.Outputs) == 0 {
+		p.Outputs = stringsFlag{"contests"}
+	}
+	for idx, out := range p.Outputs {
+		dir, err := parseOutput(out)
+		if err != nil {
+			log.Fatal("parse output", zap.Error(err))
+		}
+		p.Outputs[idx] = dir
+	}
+	// state of previous run is read from the first output
+	p.Output = p.Outputs[0]
+
+	cli, err := p.newClient()
+	if err != nil {
+		log.Fatal("create client", zap.Error(err))
 	}
+	p.cli = cli
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
@@ -52,13 +136,45 @@ func main() {
 		cancel()
 	}()
 
-	err := p.Run(ctx)
+	if p.Roles != "" {
+		roles, perr := parseRoles(p.Roles)
+		if perr != nil {
+			log.Fatal("parse roles", zap.Error(perr))
+		}
+		err = p.RunRoles(ctx, roles)
+	} else {
+		err = p.Run(ctx)
+	}
 	if err != nil {
 		log.Error("run parser", zap.Error(err))
+		var writeErr *WriteError
+		if errors.As(err, &writeErr) {
+			os.Exit(exitWriteError)
+		}
+		os.Exit(exitError)
 	}
 	log.Info("run parser succeeded")
 }
 
+// paramsFlag collects repeated key=value flags.
+type paramsFlag url.Values
+
+func (pf *paramsFlag) String() string {
+	return url.Values(*pf).Encode()
+}
+
+func (pf *paramsFlag) Set(raw string) error {
+	eq := strings.IndexByte(raw, '=')
+	if eq <= 0 {
+		return fmt.Errorf("expected key=value, got %q", raw)
+	}
+	if *pf == nil {
+		*pf = make(paramsFlag)
+	}
+	url.Values(*pf).Add(raw[:eq], raw[eq+1:])
+	return nil
+}
+
 type Emitters struct {
 	HrefEmitter
 	ProblemsEmitter
@@ -66,23 +182,295 @@ type Emitters struct {
 	StandingsEmitter
 }
 
+// SSOConfig describes an institutional login which must be passed before the contest login.
+type SSOConfig struct {
+	URL                          string
+	Username, Password           string
+	UsernameField, PasswordField string
+}
+
 type Parser struct {
 	Username, Password string
+	LoginField         string
+	PasswordField      string
 	ContestID          int
+	Role               int
+	Roles              string
 	BaseURL            string
+	ProbePath          bool
+	Preflight          bool
 	Output             string
+	Outputs            stringsFlag
 	Force              bool
 
-	cli *http.Client
+	ForceHTTP1            bool
+	MinTLSVersion         string
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	Retries               int
+	RetryOn               string
+	SSO                   SSOConfig
+	Cookies               paramsFlag
+	CookieFile            string
+	// SkipLogin uses injected cookies as the session and BaseURL as the contest page.
+	SkipLogin bool
+
+	AllRuns           bool
+	OwnRunsOnly       bool
+	SubmissionsParams paramsFlag
+	RunIDsFile        string
+	Problem           string
+	TeamName          string
+	MaxSize           int64
+	Statements        bool
+	ResolveLanguages  bool
+	LanguageMap       string
+	SkipBinary        bool
+	SkipBadRows       bool
+	SourceName        string
+	StreamSources     bool
+	Verify            string
+
+	Incremental    bool
+	DeltaOnly      bool
+	IncludeRaw     bool
+	IncludeHeaders bool
+	IncludeDiffs   bool
+	Polygon        bool
+	PrintSelectors bool
+	WriteHistory   bool
+	VerifyCompile  bool
+	PdfFont        string
+	Format         string
+	RunsCSV        bool
+	RunsCSVColumns string
+	RenameFields   string
+
+	SimilarityThreshold float64
+
+	cli        *http.Client
+	cookies    []injectedCookie
+	state      *State
+	snapshot   *State
+	runColumns []string
+	fieldNames map[string]string
+	similar    []SimilarPair
+	compiled   []CompileResult
+
+	loginMu   sync.Mutex
+	loginURL  *url.URL
+	loginCall *loginCall
 
 	Emitters
 }
 
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// logResponse logs negotiated protocol and TLS version of the response.
+func logResponse(resp *http.Response) {
+	fields := []zap.Field{
+		zap.Stringer("url", resp.Request.URL),
+		zap.Int("code", resp.StatusCode),
+		zap.String("proto", resp.Proto),
+	}
+	if resp.TLS != nil {
+		fields = append(fields, zap.String("tls", tlsVersionName(resp.TLS.Version)))
+	}
+	log.Debug("response", fields...)
+}
+
+func (p *Parser) newClient() (*http.Client, error) {
+	minVersion, ok := tlsVersions[p.MinTLSVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q", p.MinTLSVersion)
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{MinVersion: minVersion}
+	tr.DialContext = (&net.Dialer{
+		Timeout:   p.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	tr.ResponseHeaderTimeout = p.ResponseHeaderTimeout
+	tr.ForceAttemptHTTP2 = !p.ForceHTTP1
+	if p.ForceHTTP1 {
+		// non-nil empty map disables h2 upgrade over TLS
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	policy, err := parseRetryOn(p.RetryOn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.loadCookies(); err != nil {
+		return nil, err
+	}
+	if p.SkipLogin && len(p.cookies) == 0 {
+		return nil, errors.New("-skip-login requires session cookies from -cookie or -cookie-file")
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	p.injectCookies(jar)
+
+	return &http.Client{
+		Transport: &retryTransport{
+			next:    tr,
+			policy:  policy,
+			retries: p.Retries,
+			backoff: 500 * time.Millisecond,
+		},
+		Jar:     jar,
+		Timeout: 5 * time.Second,
+	}, nil
+}
+
 func (p *Parser) InitEmitters(u *url.URL) {
 	p.SubmissionsEmitter.cli = p.cli
+	p.SubmissionsEmitter.originalHref = u
+	p.SubmissionsEmitter.allSources = p.IncludeDiffs
+	p.SubmissionsEmitter.skipBinary = p.SkipBinary
+	p.SubmissionsEmitter.maxSize = p.MaxSize
+	p.SubmissionsEmitter.retries = p.Retries
+	p.SubmissionsEmitter.progress = func(u *url.URL, read, total int64) {
+		log.Debug("download source", zap.Stringer("url", u), zap.Int64("read", read), zap.Int64("total", total))
+	}
+	if p.state != nil {
+		p.SubmissionsEmitter.cached = func(submission *Submission) ([]byte, bool) {
+			return p.state.cachedSource(p.Output, submission)
+		}
+	}
 	p.HrefEmitter.originalHref = u
+	p.HrefEmitter.allRuns = p.AllRuns
+	p.HrefEmitter.submissionsParams = url.Values(p.SubmissionsParams)
+	if p.OwnRunsOnly {
+		p.HrefEmitter.ownLogin = p.Username
+	}
 	p.StandingsEmitter.originalHref = u
+	p.StandingsEmitter.team = p.TeamName
+	if p.TeamName == "" {
+		p.StandingsEmitter.team = p.Username
+	}
 	p.ProblemsEmitter.originalHref = u
+	p.ProblemsEmitter.pdfFont = p.PdfFont
+	p.ProblemsEmitter.skipBadRows = p.SkipBadRows
+	p.StandingsEmitter.pdfFont = p.PdfFont
+}
+
+const (
+	defaultLoginField    = "login"
+	defaultPasswordField = "password"
+)
+
+// loginForm fetches the login page and detects credential fields, hidden inputs and submit url.
+func (p *Parser) loginForm(ctx context.Context, u *url.URL) *LoginFormEmitter {
+	loginPage := *u
+	q := make(url.Values)
+	q.Set("contest_id", strconv.Itoa(p.ContestID))
+	loginPage.RawQuery = q.Encode()
+
+	form := &LoginFormEmitter{originalHref: &loginPage}
+	if err := p.Do(ctx, &loginPage, form); err != nil {
+		log.Warn("detect login form", zap.Error(err))
+		form = &LoginFormEmitter{
+			Action:        u,
+			Method:        http.MethodPost,
+			LoginField:    defaultLoginField,
+			PasswordField: defaultPasswordField,
+		}
+	}
+
+	if p.LoginField != "" {
+		form.LoginField = p.LoginField
+	}
+	if p.PasswordField != "" {
+		form.PasswordField = p.PasswordField
+	}
+	log.Debug("login form",
+		zap.Stringer("action", form.Action),
+		zap.String("method", form.Method),
+		zap.String("login", form.LoginField),
+		zap.String("password", form.PasswordField),
+		zap.Strings("hidden", hiddenNames(form.Hidden)),
+	)
+	return form
+}
+
+func hiddenNames(hidden url.Values) []string {
+	names := make([]string, 0, len(hidden))
+	for name := range hidden {
+		names = append(names, name)
+	}
+	return names
+}
+
+const contestActionsSelector = `.user_actions .contest_actions_item > a`
+
+const (
+	enterLinkSelector   = `a[href]:contains("Enter contest")`
+	enterButtonSelector = `input[type=submit][value*="Enter"], button:contains("Enter")`
+)
+
+func enterForm(doc *goquery.Selection) *goquery.Selection {
+	return doc.Find(`form`).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.Find(enterButtonSelector).Length() != 0
+	}).First()
+}
+
+// hasEnterContest reports whether the page asks to confirm entering the contest.
+func hasEnterContest(doc *goquery.Selection) bool {
+	return doc.Find(enterLinkSelector).Length() != 0 || enterForm(doc).Length() != 0
+}
+
+// enterContest follows the "Enter contest" link or form shown by some contests after login.
+func (p *Parser) enterContest(ctx context.Context, base *url.URL, doc *goquery.Selection) (*goquery.Document, error) {
+	method := http.MethodGet
+	q := make(url.Values)
+
+	target, found := doc.Find(enterLinkSelector).Attr("href")
+	if !found {
+		form := enterForm(doc)
+		if form.Length() == 0 {
+			return nil, fmt.Errorf("enter contest form not found")
+		}
+		target, _ = form.Attr("action")
+		if m, _ := form.Attr("method"); strings.EqualFold(m, http.MethodPost) {
+			method = http.MethodPost
+		}
+		form.Find(`input[name]:not([type=submit]), input[type=submit][name][value*="Enter"], button[name]`).Each(func(_ int, s *goquery.Selection) {
+			name, _ := s.Attr("name")
+			value, _ := s.Attr("value")
+			q.Add(name, value)
+		})
+	}
+
+	u, err := resolveHref(base, target)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.submitForm(ctx, method, u, q)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return goquery.NewDocumentFromReader(resp.Body)
 }
 
 func (p *Parser) loginContest(ctx context.Context) (*url.URL, error) {
@@ -90,57 +478,407 @@ func (p *Parser) loginContest(ctx context.Context) (*url.URL, error) {
 	if err != nil {
 		return nil, err
 	}
+	if p.ProbePath {
+		if u, err = p.probePath(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+
+	form := p.loginForm(ctx, u)
 
 	q := make(url.Values)
-	q.Set("login", p.Username)
-	q.Set("password", p.Password)
-	q.Set("role", "0")
+	for name, values := range form.Hidden {
+		q[name] = values
+	}
+	q.Set(form.LoginField, p.Username)
+	q.Set(form.PasswordField, p.Password)
+	q.Set("role", strconv.Itoa(p.Role))
 	q.Set("locale_id", "0")
 	q.Set("submit", "Log in")
 	q.Set("contest_id", strconv.Itoa(p.ContestID))
 
-	u.RawQuery = q.Encode()
-
-	log.Debug("url", zap.Stringer("url", u))
-	req := &http.Request{
-		Method: http.MethodGet,
-		URL:    u,
-	}
-
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	req = req.WithContext(cctx)
-	resp, err := p.cli.Do(req)
+	log.Debug("url", zap.Stringer("url", form.Action))
+	if form.Method == http.MethodGet {
+		log.Warn("login form uses GET, credentials are sent in url")
+	}
+	resp, err := p.submitForm(cctx, form.Method, form.Action, q)
 	if err != nil {
-		log.Error("do request", zap.Error(err))
 		return nil, err
 	}
 	defer resp.Body.Close()
-	log.Debug("code", zap.Int("code", resp.StatusCode))
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	href, found := doc.Find(`.user_actions .contest_actions_item > a`).Attr("href")
+	if doc.Find(contestActionsSelector).Length() == 0 {
+		if err := serverError(doc.Selection); err != nil {
+			return nil, fmt.Errorf("login: %w", err)
+		}
+		if containsAny(doc.Text(), notStartedMessages) {
+			return nil, ErrContestNotStarted
+		}
+		if hasEnterContest(doc.Selection) {
+			log.Info("contest actions not found, entering contest")
+			doc, err = p.enterContest(cctx, resp.Request.URL, doc.Selection)
+			if err != nil {
+				return nil, fmt.Errorf("enter contest: %w", err)
+			}
+		}
+	}
+
+	href, found := doc.Find(contestActionsSelector).Attr("href")
 	if !found {
 		raw, _ := doc.Html()
 		print(raw)
-		return nil, fmt.Errorf("href not found")
+		return nil, fmt.Errorf("login: contest actions href not found (status %q)", resp.Status)
+	}
+
+	if id, ok := pageContestID(resp.Request.URL, doc.Selection); !ok {
+		log.Debug("contest id not found on contest page")
+	} else if id != p.ContestID {
+		return nil, &ContestMismatchError{Want: p.ContestID, Got: id}
 	}
 
-	return url.Parse(href)
+	return resolveHref(resp.Request.URL, href)
+}
+
+// submitForm sends form values q to u with POST in the body or with GET in the query.
+func (p *Parser) submitForm(ctx context.Context, method string, u *url.URL, q url.Values) (*http.Response, error) {
+	var body io.Reader
+	target := *u
+	if method == http.MethodPost {
+		body = strings.NewReader(q.Encode())
+	} else if len(q) != 0 {
+		target.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := p.cli.Do(req)
+	if err != nil {
+		log.Error("do request", zap.Error(err), zap.Stringer("url", u))
+		return nil, err
+	}
+	logResponse(resp)
+	return resp, nil
+}
+
+// preAuth logs in to the SSO in front of the contest, the issued cookies are kept in the client jar.
+func (p *Parser) preAuth(ctx context.Context) error {
+	if p.SSO.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(p.SSO.URL)
+	if err != nil {
+		return err
+	}
+
+	username, password := p.SSO.Username, p.SSO.Password
+	if username == "" {
+		username = p.Username
+	}
+	if password == "" {
+		password = p.Password
+	}
+	q := make(url.Values)
+	q.Set(p.SSO.UsernameField, username)
+	q.Set(p.SSO.PasswordField, password)
+
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := p.submitForm(cctx, http.MethodPost, u, q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("sso login: unexpected status %q", resp.Status)
+	}
+	log.Debug("sso login", zap.Int("cookies", len(p.cli.Jar.Cookies(resp.Request.URL))))
+	return nil
+}
+
+// loginCall is an in-flight login, its result is shared by all callers waiting for it.
+type loginCall struct {
+	done chan struct{}
+	u    *url.URL
+	err  error
+}
+
+// login logs in once per process. Concurrent callers wait for the in-flight login and share its result,
+// including the error. Callers coming after a failed login try again.
+func (p *Parser) login(ctx context.Context) (*url.URL, error) {
+	p.loginMu.Lock()
+	if p.loginURL != nil {
+		defer p.loginMu.Unlock()
+		return p.loginURL, nil
+	}
+	if call := p.loginCall; call != nil {
+		p.loginMu.Unlock()
+		select {
+		case <-call.done:
+			return call.u, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &loginCall{done: make(chan struct{})}
+	p.loginCall = call
+	p.loginMu.Unlock()
+
+	call.u, call.err = p.authorizeContest(ctx)
+
+	p.loginMu.Lock()
+	if call.err == nil {
+		p.loginURL = call.u
+	}
+	p.loginCall = nil
+	p.loginMu.Unlock()
+	close(call.done)
+	return call.u, call.err
+}
+
+// authorizeContest logs in, a stale session of another contest is dropped and the login is repeated.
+func (p *Parser) authorizeContest(ctx context.Context) (*url.URL, error) {
+	u, err := p.authorize(ctx)
+	var mismatch *ContestMismatchError
+	if errors.As(err, &mismatch) {
+		// stale session cookies may point to another contest, start from scratch
+		log.Warn("wrong contest after login, retrying with new session", zap.Int("got", mismatch.Got))
+		if err := p.resetSession(false); err != nil {
+			return nil, err
+		}
+		u, err = p.authorize(ctx)
+	}
+	return u, err
+}
+
+// resetSession drops cookies and the contest url of the previous login.
+// Cookies of -cookie and -cookie-file are set again if inject is true.
+func (p *Parser) resetSession(inject bool) error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	if inject {
+		p.injectCookies(jar)
+	}
+	p.cli.Jar = jar
+	p.loginMu.Lock()
+	p.loginURL = nil
+	p.loginMu.Unlock()
+	return nil
+}
+
+func (p *Parser) authorize(ctx context.Context) (*url.URL, error) {
+	if p.SkipLogin {
+		log.Info("login skipped, using injected session cookies")
+		return url.Parse(p.BaseURL)
+	}
+	if err := p.preAuth(ctx); err != nil {
+		return nil, fmt.Errorf("pre-auth: %w", err)
+	}
+	return p.loginContest(ctx)
+}
+
+// readRunIDs reads run ids one per line. Invalid lines are reported and skipped.
+func readRunIDs(path string) (map[int]bool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	runIDs := make(map[int]bool)
+	for idx, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		runID, err := strconv.Atoi(line)
+		if err != nil || runID <= 0 {
+			log.Warn("invalid run id", zap.String("file", path), zap.Int("line", idx+1), zap.String("value", line))
+			continue
+		}
+		runIDs[runID] = true
+	}
+	return runIDs, nil
 }
 
 func (p *Parser) Run(ctx context.Context) error {
+	if p.Incremental || p.DeltaOnly {
+		state, err := loadState(p.Output)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			log.Info("previous state not found, fetching all sources")
+		}
+		p.state = state
+	}
+
+	if p.RunIDsFile != "" {
+		runIDs, err := readRunIDs(p.RunIDsFile)
+		if err != nil {
+			return err
+		}
+		p.SubmissionsEmitter.runIDs = runIDs
+	}
+
+	sourceName := p.SourceName
+	if sourceName == "" {
+		sourceName = defaultSourceName
+		if p.RunIDsFile != "" {
+			sourceName = runSourceName
+		}
+	}
+	sourceNameTmpl, err := parseSourceName(sourceName)
+	if err != nil {
+		return err
+	}
+
+	if p.Format != "" && p.Format != "md" {
+		return fmt.Errorf("unsupported report format %q", p.Format)
+	}
+	if p.RenameFields != "" {
+		if p.fieldNames, err = loadFieldNames(p.RenameFields); err != nil {
+			return err
+		}
+	}
+	if p.RunsCSV {
+		if p.runColumns, err = parseRunColumns(p.RunsCSVColumns); err != nil {
+			return err
+		}
+	}
+
+	if p.ResolveLanguages || p.LanguageMap != "" {
+		languages, err := loadLanguages(p.LanguageMap)
+		if err != nil {
+			return err
+		}
+		p.SubmissionsEmitter.languages = languages
+	}
+
+	if p.Verify != "" {
+		if p.snapshot, err = readState(p.Verify); err != nil {
+			return fmt.Errorf("read snapshot: %w", err)
+		}
+	}
+
+	sinks := make([]*ManifestSink, 0, len(p.Outputs))
+	for _, out := range p.Outputs {
+		sinks = append(sinks, NewManifestSink(out))
+	}
+
+	if p.StreamSources {
+		if err := p.checkStreamSources(); err != nil {
+			return err
+		}
+		// outputs are prepared before fetching to write sources as they come
+		var streamed []OutputSink
+		for _, sink := range sinks {
+			if err := sink.Prepare(p.Force); err != nil {
+				return fmt.Errorf("output %q: %w", sink.Dir, err)
+			}
+			streamed = append(streamed, sink)
+		}
+		p.SubmissionsEmitter.onSource = streamSources(sourceNameTmpl, streamed)
+	}
+
 	if err := p.GetData(ctx); err != nil {
 		log.Error("get data", zap.Error(err))
 		return err
 	}
 
-	return p.WriteData(p.Output)
+	if len(p.BadRows) != 0 {
+		log.Warn("skipped problem rows", zap.Int("count", len(p.BadRows)), zap.Errors("errors", p.BadRows))
+	}
+
+	if err := setSourcePaths(sourceNameTmpl, p.Submissions); err != nil {
+		return err
+	}
+
+	p.CrossCheckStandings()
+	setSolvedLanguages(p.Problems, p.Runs)
+
+	if p.PrintSelectors {
+		p.PrintSelectorsUsed()
+	}
+
+	if p.IncludeDiffs {
+		diffAttempts(p.Runs)
+	}
+
+	if p.VerifyCompile {
+		if p.compiled, err = VerifyCompile(ctx, p.Submissions); err != nil {
+			log.Warn("verify compile", zap.Error(err))
+		}
+	}
+
+	if p.SimilarityThreshold > 0 {
+		p.similar = p.compareSources()
+		for _, pair := range p.similar {
+			log.Warn("similar sources",
+				zap.Int("run_a", pair.A.RunID),
+				zap.Int("run_b", pair.B.RunID),
+				zap.String("problem_a", pair.A.ProblemID),
+				zap.String("problem_b", pair.B.ProblemID),
+				zap.Float64("similarity", pair.Similarity),
+			)
+		}
+	}
+
+	if p.Verify != "" {
+		return p.verifySnapshot()
+	}
+
+	var errs error
+	for _, sink := range sinks {
+		if !p.StreamSources {
+			if err := sink.Prepare(p.Force || p.Incremental || p.DeltaOnly); err != nil {
+				errs = multierr.Append(errs, fmt.Errorf("output %q: %w", sink.Dir, err))
+				continue
+			}
+		}
+		var err error
+		if p.DeltaOnly {
+			err = p.WriteDelta(sink)
+		} else {
+			err = p.WriteData(sink)
+		}
+		if err == nil {
+			err = sink.WriteManifest(p.Problems, p.Submissions)
+		}
+		errs = multierr.Append(errs, err)
+	}
+	return errs
+}
+
+// compareSources compares sources of all runs if they are fetched by -include-diffs, final submissions otherwise.
+func (p *Parser) compareSources() []SimilarPair {
+	if p.IncludeDiffs {
+		return CompareSources(p.Runs, p.SimilarityThreshold)
+	}
+	return CompareSources(p.Submissions, p.SimilarityThreshold)
+}
+
+// ServerError is an error message rendered by the server on a page with successful status.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "server error: " + e.Message
 }
 
 func processBody(ctx context.Context, body io.Reader, emitter Emitter) error {
@@ -148,31 +886,51 @@ func processBody(ctx context.Context, body io.Reader, emitter Emitter) error {
 	if err != nil {
 		return err
 	}
+	if err := serverError(doc.Selection); err != nil {
+		return err
+	}
 	return emitter.Emit(ctx, doc.Selection)
 }
 
-func (p *Parser) Do(ctx context.Context, u *url.URL, emit Emitter) error {
-	req := &http.Request{
-		Method: http.MethodGet,
-		URL:    u,
+// serverError returns the error message rendered on the page, nil if there is none.
+func serverError(doc *goquery.Selection) error {
+	msg := strings.TrimSpace(doc.Find(`.error, #error, .server_error`).First().Text())
+	if msg == "" {
+		return nil
 	}
+	return &ServerError{Message: msg}
+}
+
+// Do fetches u and passes the page to emit. Panic of the emitter is returned as an error.
+func (p *Parser) Do(ctx context.Context, u *url.URL, emit Emitter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Debug("emitter panic", zap.Any("panic", r), zap.Stringer("url", u), zap.Stack("stack"))
+			err = fmt.Errorf("%T: %s: panic: %v", emit, u, r)
+		}
+	}()
 
 	cctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	req = req.WithContext(cctx)
+	// the request must have a header, the client adds cookies of the jar to it
+	req, err := http.NewRequestWithContext(cctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
 	resp, err := p.cli.Do(req)
 	if err != nil {
 		log.Error("do request", zap.Error(err), zap.Stringer("url", u))
 		return err
 	}
 	defer resp.Body.Close()
+	logResponse(resp)
 
 	return processBody(cctx, resp.Body, emit)
 }
 
 func (p *Parser) GetData(ctx context.Context) error {
-	uri, err := p.loginContest(ctx)
+	uri, err := p.login(ctx)
 	if err != nil {
 		log.Error("login failed", zap.Error(err))
 		return err
@@ -185,6 +943,15 @@ func (p *Parser) GetData(ctx context.Context) error {
 		log.Error("parse hrefs", zap.Error(err))
 		return err
 	}
+	if p.ContestTitle != "" {
+		log.Info("contest", zap.String("title", p.ContestTitle))
+	}
+
+	if p.Preflight {
+		if err := p.CheckPages(ctx); err != nil {
+			return err
+		}
+	}
 
 	for _, runData := range []struct {
 		Emitter
@@ -192,7 +959,6 @@ func (p *Parser) GetData(ctx context.Context) error {
 	}{
 		{&p.ProblemsEmitter, p.SummaryHref},
 		{&p.StandingsEmitter, p.StandingsHref},
-		{&p.SubmissionsEmitter, p.SubmissionsHref},
 	} {
 		log := log.With(
 			zap.Stringer("url", runData.URL),
@@ -205,6 +971,188 @@ func (p *Parser) GetData(ctx context.Context) error {
 		log.Info("emit")
 	}
 
+	if p.Problem != "" {
+		if _, err := p.SubmissionsForProblem(ctx, p.Problem); err != nil {
+			log.Error("emit submissions of problem", zap.String("problem", p.Problem), zap.Error(err))
+			return err
+		}
+	} else if err := p.Do(ctx, p.SubmissionsHref, &p.SubmissionsEmitter); err != nil {
+		log.Error("emit", zap.Stringer("url", p.SubmissionsHref), zap.Error(err))
+		return err
+	}
+
+	if p.Statements || p.Polygon {
+		return p.GetStatements(ctx)
+	}
+	return nil
+}
+
+// SubmissionsForProblem fetches submissions of a single problem from the submissions page filtered by its ejudge id.
+// Problems and hrefs must be parsed before.
+func (p *Parser) SubmissionsForProblem(ctx context.Context, problemID string) ([]*Submission, error) {
+	var problem *Problem
+	for _, pr := range p.Problems {
+		if pr.ID == problemID {
+			problem = pr
+			break
+		}
+	}
+	if problem == nil {
+		return nil, fmt.Errorf("problem %q not found", problemID)
+	}
+	if problem.probID == 0 {
+		return nil, fmt.Errorf("ejudge id of problem %q not found", problemID)
+	}
+
+	u := *p.SubmissionsHref
+	q := u.Query()
+	q.Set("prob_id", strconv.Itoa(problem.probID))
+	u.RawQuery = q.Encode()
+
+	// the server may ignore the filter, so rows of other problems are skipped too
+	p.SubmissionsEmitter.problemID = problemID
+	if err := p.Do(ctx, &u, &p.SubmissionsEmitter); err != nil {
+		return nil, err
+	}
+	return p.Submissions, nil
+}
+
+// SelectorsUsed are sources of parsed fields as written to selectors.json.
+type SelectorsUsed struct {
+	Problems    map[string]string
+	Submissions map[string]string
+}
+
+func (p *Parser) selectorsUsed() SelectorsUsed {
+	problems := FieldSources(p.ProblemHeaders, problemColumns)
+	problems["statementHref"] = "a[href] in \"Short name\" column"
+	submissions := FieldSources(p.SubmissionHeaders, submissionColumns)
+	submissions["sourceHref"] = `a:contains("View")[href], or form with "View" button`
+	return SelectorsUsed{Problems: problems, Submissions: submissions}
+}
+
+func (p *Parser) PrintSelectorsUsed() {
+	used := p.selectorsUsed()
+	log.Info("selectors used",
+		zap.Any("problems", used.Problems),
+		zap.Any("submissions", used.Submissions),
+	)
+}
+
+// CrossCheckStandings warns if problems solved according to the summary differ from the standings row of the team
+// and returns ids of such problems.
+func (p *Parser) CrossCheckStandings() (mismatched []string) {
+	if p.StandingsEmitter.Solved == nil {
+		log.Warn("team row not found in standings", zap.String("team", p.StandingsEmitter.team))
+		return nil
+	}
+
+	inStandings := make(map[string]bool)
+	for _, id := range p.StandingsEmitter.Solved {
+		inStandings[id] = true
+	}
+	for _, problem := range p.Problems {
+		if problem.OK != inStandings[problem.ID] {
+			log.Warn("solved status differs between summary and standings",
+				zap.String("problem", problem.ID),
+				zap.Bool("summary", problem.OK),
+				zap.Bool("standings", inStandings[problem.ID]),
+			)
+			mismatched = append(mismatched, problem.ID)
+		}
+	}
+	return mismatched
+}
+
+// diffAttempts sets diff of every earlier attempt of a problem against its final accepted attempt.
+// The latest attempt is used if the problem is not accepted.
+func diffAttempts(runs []*Submission) {
+	attempts := make(map[string][]*Submission)
+	for _, run := range runs {
+		attempts[run.ProblemID] = append(attempts[run.ProblemID], run)
+	}
+
+	for _, problemRuns := range attempts {
+		// runs are ordered newest first
+		target := 0
+		for idx, run := range problemRuns {
+			if run.OK {
+				target = idx
+				break
+			}
+		}
+		final := problemRuns[target]
+		for _, run := range problemRuns[target+1:] {
+			run.Diff = unifiedDiff(
+				fmt.Sprintf("run-%d", run.RunID),
+				fmt.Sprintf("run-%d", final.RunID),
+				run.Source, final.Source,
+			)
+		}
+	}
+}
+
+func (p *Parser) GetStatements(ctx context.Context) error {
+	for _, problem := range p.Problems {
+		if problem.statementHref == nil {
+			log.Warn("statement href not found", zap.String("problem", problem.ID))
+			continue
+		}
+		if err := p.Do(ctx, problem.statementHref, &StatementEmitter{Problem: problem}); err != nil {
+			return fmt.Errorf("statement %q: %w", problem.ID, err)
+		}
+		log.Debug("statement", zap.String("problem", problem.ID), zap.Int("samples", len(problem.Samples)))
+
+		if problem.pdfHref == nil {
+			continue
+		}
+		raw, contentType, err := p.download(ctx, problem.pdfHref)
+		if err != nil {
+			return fmt.Errorf("statement pdf %q: %w", problem.ID, err)
+		}
+		if !strings.HasPrefix(contentType, "application/pdf") {
+			log.Warn("statement is not pdf", zap.String("problem", problem.ID), zap.String("content_type", contentType))
+			continue
+		}
+		problem.pdf = raw
+	}
+	return nil
+}
+
+// download fetches the body of u limited by MaxSize and returns it with its content type.
+func (p *Parser) download(ctx context.Context, u *url.URL) ([]byte, string, error) {
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(cctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := p.cli.Do(req)
+	if err != nil {
+		log.Error("do request", zap.Error(err), zap.Stringer("url", u))
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	raw, err := readLimited(resp.Body, resp.ContentLength, p.MaxSize, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, resp.Header.Get("Content-Type"), nil
+}
+
+func writeSamples(sink OutputSink, dir string, samples []SampleTest) error {
+	for idx, sample := range samples {
+		for ext, data := range map[string]string{".in": sample.Input, ".out": sample.Output} {
+			if err := sink.WriteFile(filepath.Join(dir, strconv.Itoa(idx+1)+ext), []byte(data)); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -216,8 +1164,11 @@ func fileName(lang string) string {
 		return "main.c"
 	case strings.Contains(lang, "python"):
 		return "main.py"
+	case strings.Contains(lang, "fpc"), strings.Contains(lang, "pascal"):
+		return "main.pas"
 	default:
-		panic(lang)
+		// sources of unknown languages are kept as plain text
+		return "main.txt"
 	}
 }
 
@@ -225,67 +1176,243 @@ type PdfWriter interface {
 	GeneratePdf(w io.Writer) error
 }
 
-func writePdf(writer PdfWriter, path ...string) error {
-	out := filepath.Join(path...)
-	file, err := os.Create(out)
-	if err != nil {
-		return fmt.Errorf("standings: %w", err)
+func writePdf(sink OutputSink, writer PdfWriter, name string) error {
+	// generate in memory to tell generation errors from write errors
+	buf := new(bytes.Buffer)
+	if err := writer.GeneratePdf(buf); err != nil {
+		return fmt.Errorf("generate %q: %w", name, err)
 	}
-	defer file.Close()
+	return sink.WriteFile(name, buf.Bytes())
+}
 
-	if err := writer.GeneratePdf(file); err != nil {
-		return fmt.Errorf("generate %q: %w", out, err)
+// WriteError is returned when the output can not be written, e.g. the disk is full.
+type WriteError struct {
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("write file: %q: %v", e.Path, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+func writeFile(path string, data []byte) error {
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return &WriteError{Path: path, Err: err}
 	}
 	return nil
 }
 
-func (p *Parser) WriteData(out string) error {
-	stat, err := os.Stat(out)
-	if err != nil {
-		if !os.IsNotExist(err) {
+func (p *Parser) WriteData(sink OutputSink) error {
+	if err := writePdf(sink, &p.StandingsEmitter, "standings.pdf"); err != nil {
+		return err
+	}
+
+	if err := writePdf(sink, &p.ProblemsEmitter, "summary.pdf"); err != nil {
+		return err
+	}
+
+	if p.IncludeRaw {
+		for name, raw := range map[string]string{
+			"summary.html":     p.SummaryTable,
+			"submissions.html": p.SubmissionsTable,
+			"standings.html":   p.StandingsPage,
+		} {
+			if err := sink.WriteFile(name, []byte(raw)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.IncludeHeaders {
+		err := p.writeOutputJSON(sink, "headers.json", struct {
+			ProblemHeaders    []string
+			SubmissionHeaders []string
+		}{p.ProblemHeaders, p.SubmissionHeaders})
+		if err != nil {
 			return err
 		}
 	}
-	if stat != nil {
-		if stat.IsDir() && !p.Force {
-			return errors.New("output directory exists")
+
+	if p.PrintSelectors {
+		if err := p.writeOutputJSON(sink, "selectors.json", p.selectorsUsed()); err != nil {
+			return err
 		}
-		if !stat.IsDir() {
-			return errors.New("output path is file")
+	}
+
+	if p.VerifyCompile {
+		if err := p.writeOutputJSON(sink, "compile.json", p.compiled); err != nil {
+			return err
 		}
 	}
-	if err := os.MkdirAll(out, os.ModePerm); err != nil {
-		return err
+
+	if p.Format == "md" {
+		raw, err := MarkdownReport(p.ContestTitle, p.Problems, p.Submissions)
+		if err != nil {
+			return err
+		}
+		if err := sink.WriteFile("report.md", raw); err != nil {
+			return err
+		}
 	}
 
-	if err := writePdf(&p.StandingsEmitter, out, "standings.pdf"); err != nil {
-		return err
+	if p.RunsCSV {
+		raw, err := RunsCSV(p.Runs, p.runColumns)
+		if err != nil {
+			return err
+		}
+		if err := sink.WriteFile("runs.csv", raw); err != nil {
+			return err
+		}
 	}
 
-	if err := writePdf(&p.ProblemsEmitter, out, "summary.pdf"); err != nil {
-		return err
+	if p.WriteHistory {
+		err := p.writeOutputJSON(sink, "history.json", struct {
+			History map[string][]SubmissionEvent
+		}{History(p.Runs)})
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.SimilarityThreshold > 0 {
+		if err := p.writeOutputJSON(sink, "similar.json", similarRuns(p.similar)); err != nil {
+			return err
+		}
 	}
 
 	problemsMap := make(map[string]*Problem)
 	for _, problem := range p.Problems {
 		problemsMap[problem.ID] = problem
+		if err := writeSamples(sink, filepath.Join(problem.ID, "samples"), problem.Samples); err != nil {
+			return err
+		}
+		if problem.pdf != nil {
+			problem.StatementPDF = filepath.Join(problem.ID, "statement.pdf")
+			if err := sink.WriteFile(problem.StatementPDF, problem.pdf); err != nil {
+				return err
+			}
+		}
+		if p.Polygon {
+			if err := writePolygonPackage(sink, filepath.Join("polygon", problem.ID), problem); err != nil {
+				return fmt.Errorf("polygon package %q: %w", problem.ID, err)
+			}
+		}
+	}
+
+	if err := p.writeOutputJSON(sink, "problems.json", problemsInfo(p.Problems)); err != nil {
+		return err
 	}
 
 	for _, submission := range p.Submissions {
-		problem, ok := problemsMap[submission.ProblemID]
-		if !ok {
+		if submission.Binary && p.SkipBinary || submission.streamed {
+			continue
+		}
+		if _, ok := problemsMap[submission.ProblemID]; !ok {
 			return fmt.Errorf("problem %q not found", submission.ProblemID)
 		}
-		problemDir := filepath.Join(out, problem.ID)
-		if err := os.MkdirAll(problemDir, os.ModePerm); err != nil {
-			return fmt.Errorf("create problem dir: %q: %w", problemDir, err)
+		if err := sink.WriteFile(submission.path, submission.Source); err != nil {
+			return err
 		}
-		path := filepath.Join(problemDir, fileName(submission.Language))
-		err := ioutil.WriteFile(path, submission.Source, 0644)
-		if err != nil {
-			return fmt.Errorf("write file: %q: %w", path, err)
+	}
+
+	if p.IncludeDiffs {
+		for _, run := range p.Runs {
+			if run.Diff == "" {
+				continue
+			}
+			name := filepath.Join(run.ProblemID, "diffs", strconv.Itoa(run.RunID)+".diff")
+			if err := sink.WriteFile(name, []byte(run.Diff)); err != nil {
+				return err
+			}
 		}
 	}
 
+	if p.Incremental {
+		return p.newState().save(sink)
+	}
+	return nil
+}
+
+// ProblemInfo is a problem as written to problems.json.
+type ProblemInfo struct {
+	ID              string
+	Name            string
+	OK              bool
+	RunID           int
+	Tags            []string
+	SolvedLanguages []string
+	StatementPDF    string `json:",omitempty"`
+}
+
+func problemsInfo(problems []*Problem) []ProblemInfo {
+	res := make([]ProblemInfo, 0, len(problems))
+	for _, problem := range problems {
+		res = append(res, ProblemInfo{
+			ID:              problem.ID,
+			Name:            problem.Name,
+			OK:              problem.OK,
+			RunID:           problem.RunID,
+			Tags:            problem.Tags,
+			SolvedLanguages: problem.SolvedLanguages,
+			StatementPDF:    problem.StatementPDF,
+		})
+	}
+	return res
+}
+
+func (p *Parser) newState() *State {
+	state := &State{
+		Problems: make(map[string]*ProblemState),
+		Sources:  make(map[int]*SourceState),
+	}
+	for _, problem := range p.Problems {
+		state.Problems[problem.ID] = &ProblemState{ID: problem.ID, OK: problem.OK}
+	}
+	for _, submission := range p.Submissions {
+		if submission.RunID == 0 || submission.Binary && p.SkipBinary {
+			continue
+		}
+		state.Sources[submission.RunID] = &SourceState{
+			RunID:     submission.RunID,
+			ProblemID: submission.ProblemID,
+			OK:        submission.OK,
+			Path:      submission.path,
+			SHA256:    sourceHash(submission.Source),
+		}
+	}
+	return state
+}
+
+// verifySnapshot reports differences of scraped data from the snapshot.
+func (p *Parser) verifySnapshot() error {
+	mismatches := p.snapshot.Mismatches(p.newState())
+	for _, change := range mismatches {
+		log.Warn("snapshot mismatch",
+			zap.String("kind", change.Kind),
+			zap.String("id", change.ID),
+			zap.String("change", change.Change),
+			zap.Bool("ok", change.OK),
+		)
+	}
+	if len(mismatches) != 0 {
+		return fmt.Errorf("%d mismatches with snapshot %q", len(mismatches), p.Verify)
+	}
+	log.Info("snapshot verified", zap.String("snapshot", p.Verify))
 	return nil
 }
+
+// WriteDelta writes changes since the previous state to delta.json and updates the state.
+func (p *Parser) WriteDelta(sink OutputSink) error {
+	next := p.newState()
+	changes := p.state.Delta(next)
+	log.Info("delta", zap.Int("changes", len(changes)))
+
+	if err := p.writeOutputJSON(sink, "delta.json", changes); err != nil {
+		return err
+	}
+	return next.save(sink)
+}
@@ -0,0 +1,758 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// memSink keeps output files in memory.
+type memSink map[string][]byte
+
+func (m memSink) WriteFile(name string, data []byte) error {
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// stubPdf replaces pdf generation, so WriteData does not need wkhtmltopdf.
+func stubPdf(t *testing.T) {
+	t.Helper()
+	generatePdf = func(raw, _ string, w io.Writer) error {
+		_, err := io.WriteString(w, "%PDF "+raw)
+		return err
+	}
+	t.Cleanup(func() { generatePdf = GeneratePdf })
+}
+
+// mustSourceName parses source name template.
+func mustSourceName(t *testing.T, text string) *template.Template {
+	t.Helper()
+	tmpl, err := parseSourceName(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+// newTestParser returns parser with defaults of the command line flags.
+func newTestParser(t *testing.T, baseURL string) *Parser {
+	t.Helper()
+	p := &Parser{
+		Username:      "selftest",
+		Password:      "selftest",
+		ContestID:     1,
+		BaseURL:       baseURL,
+		MinTLSVersion: "1.2",
+		RetryOn:       defaultRetryOn,
+		MaxSize:       1 << 20,
+	}
+	cli, err := p.newClient()
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	p.cli = cli
+	return p
+}
+
+// transportOf unwraps http.Transport of the client created by newClient.
+func transportOf(t *testing.T, cli *http.Client) *http.Transport {
+	t.Helper()
+	rt, ok := cli.Transport.(*retryTransport)
+	if !ok {
+		t.Fatalf("transport is %T, expected *retryTransport", cli.Transport)
+	}
+	tr, ok := rt.next.(*http.Transport)
+	if !ok {
+		t.Fatalf("next transport is %T, expected *http.Transport", rt.next)
+	}
+	return tr
+}
+
+func TestNewClientHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for _, tc := range []struct {
+		forceHTTP1 bool
+		protoMajor int
+	}{
+		{false, 2},
+		{true, 1},
+	} {
+		p := &Parser{MinTLSVersion: "1.2", RetryOn: defaultRetryOn, ForceHTTP1: tc.forceHTTP1}
+		cli, err := p.newClient()
+		if err != nil {
+			t.Fatalf("create client: %v", err)
+		}
+		tr := transportOf(t, cli)
+		if tr.ForceAttemptHTTP2 == tc.forceHTTP1 {
+			t.Errorf("force-http1=%v: ForceAttemptHTTP2 is %v", tc.forceHTTP1, tr.ForceAttemptHTTP2)
+		}
+		if tc.forceHTTP1 && (tr.TLSNextProto == nil || len(tr.TLSNextProto) != 0) {
+			t.Errorf("force-http1: TLSNextProto must be non-nil empty map, got %v", tr.TLSNextProto)
+		}
+		tr.TLSClientConfig.RootCAs = roots
+
+		resp, err := cli.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("force-http1=%v: %v", tc.forceHTTP1, err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != tc.protoMajor {
+			t.Errorf("force-http1=%v: got %s, expected HTTP/%d", tc.forceHTTP1, resp.Proto, tc.protoMajor)
+		}
+	}
+}
+
+// contestPage is the page shown after login, its first action is the contest url.
+const contestPage = `<html><body><input type="hidden" name="contest_id" value="1">` + selfTestMenu + `</body></html>`
+
+func TestLoginFieldOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			// the form can not be detected, so the flags must be used
+			w.Write([]byte(`<html><body>Login</body></html>`))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("my_login") != "selftest" || r.PostForm.Get("my_pass") != "secret" {
+			http.Error(w, "bad login", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(contestPage))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	p.Password = "secret"
+	p.LoginField = "my_login"
+	p.PasswordField = "my_pass"
+	u, err := p.loginContest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/summary" {
+		t.Errorf("got contest url %s", u)
+	}
+}
+
+func TestWriteRaw(t *testing.T) {
+	stubPdf(t)
+	p := &Parser{}
+	p.SummaryTable = `<table class="b1"><tr><td>A</td></tr></table>`
+	p.SubmissionsTable = `<table class="b1"><tr><td>1</td></tr></table>`
+	p.StandingsPage = `<html><body>standings</body></html>`
+
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sink["summary.html"]; ok {
+		t.Error("raw html written without -include-raw")
+	}
+
+	p.IncludeRaw = true
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"summary.html":     p.SummaryTable,
+		"submissions.html": p.SubmissionsTable,
+		"standings.html":   p.StandingsPage,
+	} {
+		if got := string(sink[name]); got != expected {
+			t.Errorf("%s: got %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestLoginCSRFToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Write([]byte(`<html><body><form action="/team.cgi" method="post">
+<input type="hidden" name="csrf_token" value="c0ffee">
+<input type="text" name="login"><input type="password" name="password">
+</form></body></html>`))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("csrf_token") != "c0ffee" {
+			http.Error(w, "csrf token mismatch", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(contestPage))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	if _, err := p.loginContest(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteProblems(t *testing.T) {
+	stubPdf(t)
+	p := &Parser{}
+	p.Problems = []*Problem{
+		{ID: "A", Name: "Sum", OK: true, RunID: 3, Tags: []string{"math"}, Statement: "<html></html>"},
+		{ID: "B", Name: "Graph"},
+	}
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []ProblemInfo
+	if err := json.Unmarshal(sink["problems.json"], &got); err != nil {
+		t.Fatalf("decode problems.json: %v", err)
+	}
+	expected := []ProblemInfo{
+		{ID: "A", Name: "Sum", OK: true, RunID: 3, Tags: []string{"math"}},
+		{ID: "B", Name: "Graph"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestCrossCheckStandings(t *testing.T) {
+	p := &Parser{}
+	p.team = "selftest"
+	if err := p.StandingsEmitter.Emit(context.Background(), testDoc(t, selfTestPages["/standings"])); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Solved, []string{"A"}) {
+		t.Fatalf("got solved %q", p.Solved)
+	}
+
+	p.Problems = []*Problem{{ID: "A", OK: true}, {ID: "B", OK: true}}
+	if got := p.CrossCheckStandings(); !reflect.DeepEqual(got, []string{"B"}) {
+		t.Errorf("got mismatched %q", got)
+	}
+
+	p.team = "nobody"
+	if err := p.StandingsEmitter.Emit(context.Background(), testDoc(t, selfTestPages["/standings"])); err != nil {
+		t.Fatal(err)
+	}
+	if p.Solved != nil || p.CrossCheckStandings() != nil {
+		t.Error("team row not found must skip the check")
+	}
+}
+
+// newSelfTestParser returns parser of the synthetic contest served by selfTestHandler, emitters are initialized with url of the contest.
+func newSelfTestParser(t *testing.T) (*Parser, *httptest.Server) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(selfTestHandler))
+	t.Cleanup(srv.Close)
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	u, err := url.Parse(srv.URL + "/contest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.InitEmitters(u)
+	return p, srv
+}
+
+func TestRunIDsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "runs.txt")
+	if err := ioutil.WriteFile(path, []byte("3\n\n 1 \nabc\n-2\n7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runIDs, err := readRunIDs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[int]bool{1: true, 3: true, 7: true}; !reflect.DeepEqual(runIDs, expected) {
+		t.Fatalf("got %v, expected %v", runIDs, expected)
+	}
+
+	p, srv := newSelfTestParser(t)
+	p.SubmissionsEmitter.runIDs = runIDs
+	u, _ := url.Parse(srv.URL + "/submissions")
+	if err := p.Do(context.Background(), u, &p.SubmissionsEmitter); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, submission := range p.Submissions {
+		got = append(got, fmt.Sprintf("%d:%s", submission.RunID, submission.Source))
+	}
+	// both runs of problem A are kept, missing run 7 is only reported
+	expected := []string{"3:" + selfTestSources["3"], "1:" + selfTestSources["1"]}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestGetStatements(t *testing.T) {
+	stubPdf(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/statement", func(w http.ResponseWriter, r *http.Request) {
+		name := map[string]string{"1": "a", "2": "b"}[r.URL.Query().Get("prob_id")]
+		fmt.Fprintf(w, `<html><body><h3>Example</h3><pre>1</pre><pre>2</pre><a href="/files/%s.pdf">PDF</a></body></html>`, name)
+	})
+	mux.HandleFunc("/files/a.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4 statement"))
+	})
+	mux.HandleFunc("/files/b.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>login required</html>"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL)
+	for idx, id := range []string{"A", "B"} {
+		u, _ := url.Parse(fmt.Sprintf("%s/statement?prob_id=%d", srv.URL, idx+1))
+		p.Problems = append(p.Problems, &Problem{ID: id, statementHref: u})
+	}
+	if err := p.GetStatements(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(sink[filepath.Join("A", "statement.pdf")]); got != "%PDF-1.4 statement" {
+		t.Errorf("statement of A: got %q", got)
+	}
+	if _, ok := sink[filepath.Join("B", "statement.pdf")]; ok {
+		t.Error("statement of B is not pdf and must be skipped")
+	}
+	if got := string(sink[filepath.Join("B", "samples", "1.out")]); got != "2" {
+		t.Errorf("sample output of B: got %q", got)
+	}
+}
+
+func TestStrictTLSVersion(t *testing.T) {
+	if _, err := (&Parser{MinTLSVersion: "1.4", RetryOn: defaultRetryOn}).newClient(); err == nil {
+		t.Error("expected error on unsupported version")
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for version, ok := range map[string]bool{"1.2": true, "1.3": false} {
+		p := &Parser{MinTLSVersion: version, RetryOn: defaultRetryOn}
+		cli, err := p.newClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := transportOf(t, cli)
+		if tr.TLSClientConfig.MinVersion != tlsVersions[version] {
+			t.Errorf("%s: got min version %s", version, tlsVersionName(tr.TLSClientConfig.MinVersion))
+		}
+		tr.TLSClientConfig.RootCAs = roots
+
+		resp, err := cli.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err == nil) != ok {
+			t.Errorf("min version %s against TLS 1.2 server: got error %v", version, err)
+		}
+	}
+}
+
+// emitterFunc adapts a function to Emitter.
+type emitterFunc func(context.Context, *goquery.Selection) error
+
+func (f emitterFunc) Emit(ctx context.Context, doc *goquery.Selection) error {
+	return f(ctx, doc)
+}
+
+func TestDoRecoversPanic(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// summary table without stylesheet link
+		w.Write([]byte(`<html><body><table class="b1"><tr><th>Short name</th></tr></table></body></html>`))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL)
+	u, _ := url.Parse(srv.URL)
+	p.ProblemsEmitter.originalHref = u
+	for _, emit := range []Emitter{
+		&p.ProblemsEmitter,
+		emitterFunc(func(context.Context, *goquery.Selection) error {
+			var problems []*Problem
+			return fmt.Errorf("unreachable %s", problems[0].ID)
+		}),
+	} {
+		err := p.Do(context.Background(), u, emit)
+		if err == nil || !strings.Contains(err.Error(), "panic") {
+			t.Errorf("%T: expected panic error, got %v", emit, err)
+		}
+	}
+
+	// the parser is usable after panic
+	err := p.Do(context.Background(), u, emitterFunc(func(context.Context, *goquery.Selection) error { return nil }))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	stubPdf(t)
+	p, srv := newSelfTestParser(t)
+	for path, emit := range map[string]Emitter{"/summary": &p.ProblemsEmitter, "/submissions": &p.SubmissionsEmitter} {
+		u, _ := url.Parse(srv.URL + path)
+		if err := p.Do(context.Background(), u, emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := setSourcePaths(mustSourceName(t, defaultSourceName), p.Submissions); err != nil {
+		t.Fatal(err)
+	}
+
+	p.IncludeHeaders = true
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	var headers struct {
+		ProblemHeaders    []string
+		SubmissionHeaders []string
+	}
+	if err := json.Unmarshal(sink["headers.json"], &headers); err != nil {
+		t.Fatalf("decode headers.json: %v", err)
+	}
+	if expected := []string{"Short name", "Long name", "Status", "Run ID"}; !reflect.DeepEqual(headers.ProblemHeaders, expected) {
+		t.Errorf("problem headers: got %q, expected %q", headers.ProblemHeaders, expected)
+	}
+	if expected := []string{"Run ID", "Time", "Problem", "Language", "Result", "View source"}; !reflect.DeepEqual(headers.SubmissionHeaders, expected) {
+		t.Errorf("submission headers: got %q, expected %q", headers.SubmissionHeaders, expected)
+	}
+}
+
+func TestPreAuthCredentials(t *testing.T) {
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r.PostForm
+		http.SetCookie(w, &http.Cookie{Name: "sso", Value: "1"})
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		username, password string
+		expected           url.Values
+	}{
+		{"", "", url.Values{"user": {"selftest"}, "pass": {"contest"}}},
+		{"sso-user", "", url.Values{"user": {"sso-user"}, "pass": {"contest"}}},
+		{"", "sso-pass", url.Values{"user": {"selftest"}, "pass": {"sso-pass"}}},
+		{"sso-user", "sso-pass", url.Values{"user": {"sso-user"}, "pass": {"sso-pass"}}},
+	} {
+		p := newTestParser(t, srv.URL)
+		p.Password = "contest"
+		p.SSO = SSOConfig{
+			URL:           srv.URL + "/sso",
+			Username:      tc.username,
+			Password:      tc.password,
+			UsernameField: "user",
+			PasswordField: "pass",
+		}
+		if err := p.preAuth(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("sso %q/%q: got %v, expected %v", tc.username, tc.password, got, tc.expected)
+		}
+		u, _ := url.Parse(srv.URL)
+		if len(p.cli.Jar.Cookies(u)) != 1 {
+			t.Error("sso cookie is not kept")
+		}
+	}
+}
+
+func TestWriteSelectors(t *testing.T) {
+	stubPdf(t)
+	p := &Parser{PrintSelectors: true}
+	p.ProblemHeaders = []string{"Short name", "Name", "Status"}
+	p.SubmissionHeaders = []string{"Run ID", "Problem", "Time used"}
+
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	var used SelectorsUsed
+	if err := json.Unmarshal(sink["selectors.json"], &used); err != nil {
+		t.Fatalf("decode selectors.json: %v", err)
+	}
+	for field, expected := range map[string]string{
+		"ID":    `column 0 "Short name"`,
+		"OK":    `column 2 "Status"`,
+		"Name":  "not found",
+		"RunID": "not found",
+	} {
+		if got := used.Problems[field]; got != expected {
+			t.Errorf("problem field %s: got %q, expected %q", field, got, expected)
+		}
+	}
+	if got := used.Submissions["MaxTimeMS"]; got != `column 2 "Time used"` {
+		t.Errorf("submission field MaxTimeMS: got %q", got)
+	}
+	if used.Submissions["sourceHref"] == "" {
+		t.Error("source link selector not recorded")
+	}
+}
+
+func TestLoginEnterContest(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		afterLogin string
+		entered    bool
+		err        string
+	}{
+		{"link", `<a href="/enter?SID=1">Enter contest</a>`, true, ""},
+		{"form", `<form action="/enter" method="post"><input type="hidden" name="SID" value="1">
+<input type="submit" name="action_enter" value="Enter contest"></form>`, true, ""},
+		{"wrong password", `<div class="server_error">Invalid login or password</div>
+<a href="/enter?SID=1">Enter contest</a>`, false, "Invalid login or password"},
+		{"unknown page", `<p>Maintenance</p>`, false, "href not found"},
+	} {
+		var entered bool
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/enter":
+				r.ParseForm()
+				entered = r.Form.Get("SID") == "1"
+				w.Write([]byte(contestPage))
+			case r.Method == http.MethodPost:
+				w.Write([]byte(`<html><body>` + tc.afterLogin + `</body></html>`))
+			default:
+				w.Write([]byte(selfTestPages["/team.cgi"]))
+			}
+		}))
+
+		p := newTestParser(t, srv.URL+"/team.cgi")
+		_, err := p.loginContest(context.Background())
+		srv.Close()
+		if entered != tc.entered {
+			t.Errorf("%s: entered %v, expected %v", tc.name, entered, tc.entered)
+		}
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestServerErrorPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div class="server_error"> Permission denied </div>` + selfTestMenu + `</body></html>`))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL)
+	u, _ := url.Parse(srv.URL)
+	p.HrefEmitter.originalHref = u
+	err := p.Do(context.Background(), u, &p.HrefEmitter)
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("expected server error, got %v", err)
+	}
+	if serverErr.Message != "Permission denied" {
+		t.Errorf("got message %q", serverErr.Message)
+	}
+	if p.SummaryHref != nil {
+		t.Error("page with server error must not be emitted")
+	}
+}
+
+func TestOwnRunsOnly(t *testing.T) {
+	u, _ := url.Parse("http://contest.example/contest")
+	for own, expected := range map[bool]string{false: "", true: `login == "judge \"1\""`} {
+		p := &Parser{Username: `judge "1"`, OwnRunsOnly: own}
+		p.InitEmitters(u)
+		if err := p.HrefEmitter.Emit(context.Background(), testDoc(t, selfTestMenu)); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.SubmissionsHref.Query().Get("filter_expr"); got != expected {
+			t.Errorf("own-runs-only=%v: got filter %q, expected %q", own, got, expected)
+		}
+	}
+}
+
+func TestLoginContestNotStarted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`<html><body><p>The contest has not started yet</p></body></html>`))
+			return
+		}
+		w.Write([]byte(selfTestPages["/team.cgi"]))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	if _, err := p.loginContest(context.Background()); !errors.Is(err, ErrContestNotStarted) {
+		t.Errorf("expected %v, got %v", ErrContestNotStarted, err)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-headers" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		// slow body is limited only by the total timeout
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer srv.Close()
+
+	p := &Parser{MinTLSVersion: "1.2", RetryOn: defaultRetryOn, DialTimeout: time.Second, ResponseHeaderTimeout: 50 * time.Millisecond}
+	cli, err := p.newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Get(srv.URL + "/slow-headers"); err == nil {
+		t.Error("expected response header timeout")
+	}
+
+	resp, err := cli.Get(srv.URL + "/slow-body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if raw, err := ioutil.ReadAll(resp.Body); err != nil || string(raw) != "done" {
+		t.Errorf("slow body: got %q, %v", raw, err)
+	}
+}
+
+func TestLoginStaleSession(t *testing.T) {
+	var logins int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Write([]byte(selfTestPages["/team.cgi"]))
+			return
+		}
+		atomic.AddInt32(&logins, 1)
+		if cookie, err := r.Cookie("EJSID"); err == nil && cookie.Value == "stale" {
+			// the server resumes the session of another contest
+			w.Write([]byte(strings.Replace(contestPage, `value="1"`, `value="2"`, 1)))
+			return
+		}
+		w.Write([]byte(contestPage))
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	u, _ := url.Parse(srv.URL)
+	p.cli.Jar.SetCookies(u, []*http.Cookie{{Name: "EJSID", Value: "stale"}})
+
+	var mismatch *ContestMismatchError
+	if _, err := p.loginContest(context.Background()); !errors.As(err, &mismatch) || mismatch.Got != 2 || mismatch.Want != 1 {
+		t.Fatalf("expected contest mismatch, got %v", err)
+	}
+	if _, err := p.login(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&logins); got != 3 {
+		t.Errorf("got %d logins, expected 3", got)
+	}
+	if len(p.cli.Jar.Cookies(u)) != 0 {
+		t.Error("stale session cookie is kept")
+	}
+}
+
+func TestLoginFormMethod(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		var submitted string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/login" {
+				r.ParseForm()
+				if r.Form.Get("login") == "selftest" && r.Form.Get("password") == "selftest" {
+					submitted = r.Method
+				}
+				w.Write([]byte(contestPage))
+				return
+			}
+			fmt.Fprintf(w, `<html><body><form action="/login" method=%q>
+<input type="text" name="login"><input type="password" name="password"></form></body></html>`, strings.ToLower(method))
+		}))
+
+		p := newTestParser(t, srv.URL+"/team.cgi")
+		_, err := p.loginContest(context.Background())
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if submitted != method {
+			t.Errorf("form method %s: credentials submitted with %q", method, submitted)
+		}
+	}
+}
+
+func TestSubmissionsForProblem(t *testing.T) {
+	var filter atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/submissions" {
+			filter.Store(r.URL.Query().Get("prob_id"))
+		}
+		// the synthetic server ignores the filter and lists runs of every problem
+		selfTestHandler(w, r)
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	p.Problem = "A"
+	if err := p.GetData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := filter.Load().(string); got != "1" {
+		t.Errorf("got prob_id %q, expected %q", got, "1")
+	}
+	for _, runs := range [][]*Submission{p.Runs, p.Submissions} {
+		if len(runs) == 0 {
+			t.Fatal("no runs parsed")
+		}
+		for _, run := range runs {
+			if run.ProblemID != "A" {
+				t.Errorf("run %d of problem %q is kept", run.RunID, run.ProblemID)
+			}
+		}
+	}
+
+	if _, err := p.SubmissionsForProblem(context.Background(), "Z"); err == nil {
+		t.Error("expected error on unknown problem")
+	}
+	p.Problems = append(p.Problems, &Problem{ID: "C"})
+	if _, err := p.SubmissionsForProblem(context.Background(), "C"); err == nil {
+		t.Error("expected error on problem without ejudge id")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestFile = "manifest.json"
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// ManifestFile describes a file written to the output dir.
+type ManifestFile struct {
+	Path      string
+	Size      int
+	SHA256    string
+	ProblemID string `json:",omitempty"`
+	RunID     int    `json:",omitempty"`
+}
+
+type Manifest struct {
+	Version   string
+	Generated time.Time
+	Files     []*ManifestFile
+}
+
+// ManifestSink records files written to the directory for manifest.json.
+type ManifestSink struct {
+	*DirSink
+	files map[string]*ManifestFile
+}
+
+func NewManifestSink(dir string) *ManifestSink {
+	return &ManifestSink{
+		DirSink: &DirSink{Dir: dir},
+		files:   make(map[string]*ManifestFile),
+	}
+}
+
+func (m *ManifestSink) WriteFile(name string, data []byte) error {
+	if err := m.DirSink.WriteFile(name, data); err != nil {
+		return err
+	}
+	name = filepath.ToSlash(filepath.Clean(name))
+	m.files[name] = &ManifestFile{Path: name, Size: len(data), SHA256: sourceHash(data)}
+	return nil
+}
+
+// WriteManifest writes manifest.json listing every file written before.
+// Files are linked to problems and submissions they belong to.
+func (m *ManifestSink) WriteManifest(problems []*Problem, submissions []*Submission) error {
+	for _, submission := range submissions {
+		if file, ok := m.files[filepath.ToSlash(submission.path)]; ok && submission.path != "" {
+			file.ProblemID = submission.ProblemID
+			file.RunID = submission.RunID
+		}
+	}
+	for _, problem := range problems {
+		for name, file := range m.files {
+			if file.ProblemID == "" && strings.HasPrefix(name, problem.ID+"/") {
+				file.ProblemID = problem.ID
+			}
+		}
+	}
+
+	manifest := Manifest{
+		Version:   version,
+		Generated: time.Now().UTC(),
+		Files:     make([]*ManifestFile, 0, len(m.files)),
+	}
+	for _, file := range m.files {
+		manifest.Files = append(manifest.Files, file)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	// written with the directory sink to keep the manifest out of itself
+	return writeJSON(m.DirSink, manifestFile, manifest)
+}
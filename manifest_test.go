@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	stubPdf(t)
+	dir := filepath.Join(t.TempDir(), "out")
+	p, _ := newSelfTestParser(t)
+	p.Outputs = stringsFlag{dir}
+	p.Output = dir
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if manifest.Version != version || manifest.Generated.IsZero() {
+		t.Errorf("got version %q generated at %v", manifest.Version, manifest.Generated)
+	}
+
+	// every file of the output except the manifest itself is listed with its checksum
+	var written []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if name != manifestFile {
+			written = append(written, filepath.ToSlash(name))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(written)
+
+	var listed []string
+	runs := make(map[int]string)
+	for _, file := range manifest.Files {
+		listed = append(listed, file.Path)
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			t.Errorf("%s: %v", file.Path, err)
+			continue
+		}
+		if file.Size != len(data) || file.SHA256 != sourceHash(data) {
+			t.Errorf("%s: got size %d and sha256 %s of %d bytes", file.Path, file.Size, file.SHA256, len(data))
+		}
+		if file.RunID != 0 {
+			runs[file.RunID] = file.ProblemID
+		}
+	}
+	if !reflect.DeepEqual(listed, written) {
+		t.Errorf("manifest lists %q, written %q", listed, written)
+	}
+	if expected := map[int]string{3: "A", 2: "B"}; !reflect.DeepEqual(runs, expected) {
+		t.Errorf("got sources of runs %v, expected %v", runs, expected)
+	}
+}
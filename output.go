@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OutputSink stores output files by path relative to the output root.
+type OutputSink interface {
+	WriteFile(name string, data []byte) error
+}
+
+// DirSink writes output files into a directory.
+type DirSink struct {
+	Dir string
+}
+
+// Prepare creates the output directory. Existing directory is reused only if overwrite is set.
+func (d *DirSink) Prepare(overwrite bool) error {
+	stat, err := os.Stat(d.Dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if stat != nil {
+		if stat.IsDir() && !overwrite {
+			return errors.New("output directory exists")
+		}
+		if !stat.IsDir() {
+			return errors.New("output path is file")
+		}
+	}
+	return os.MkdirAll(d.Dir, os.ModePerm)
+}
+
+func (d *DirSink) WriteFile(name string, data []byte) error {
+	path := filepath.Join(d.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return &WriteError{Path: filepath.Dir(path), Err: err}
+	}
+	return writeFile(path, data)
+}
+
+func writeJSON(sink OutputSink, name string, v interface{}) error {
+	raw, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return sink.WriteFile(name, raw)
+}
+
+// parseOutput parses -o value: path to the output dir optionally followed by comma separated key=value qualifiers.
+// The only supported qualifier is format=dir.
+func parseOutput(raw string) (string, error) {
+	parts := strings.Split(raw, ",")
+	if parts[0] == "" {
+		return "", fmt.Errorf("output %q: empty path", raw)
+	}
+	for _, qualifier := range parts[1:] {
+		eq := strings.IndexByte(qualifier, '=')
+		if eq <= 0 {
+			return "", fmt.Errorf("output %q: expected key=value qualifier, got %q", raw, qualifier)
+		}
+		switch key, value := qualifier[:eq], qualifier[eq+1:]; key {
+		case "format":
+			if value != "dir" {
+				return "", fmt.Errorf("output %q: unsupported format %q", raw, value)
+			}
+		default:
+			return "", fmt.Errorf("output %q: unknown qualifier %q", raw, key)
+		}
+	}
+	return parts[0], nil
+}
+
+// stringsFlag collects repeated string flags.
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(raw string) error {
+	*sf = append(*sf, raw)
+	return nil
+}
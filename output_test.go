@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// failingSink fails every write as a full disk does.
+type failingSink struct{}
+
+func (failingSink) WriteFile(name string, _ []byte) error {
+	return &WriteError{Path: name, Err: syscall.ENOSPC}
+}
+
+func TestWriteDataFailingWriter(t *testing.T) {
+	stubPdf(t)
+	p := &Parser{}
+	err := p.WriteData(failingSink{})
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	if writeErr.Path != "standings.pdf" {
+		t.Errorf("got path %q", writeErr.Path)
+	}
+}
+
+func TestDirSinkWriteError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blocked := filepath.Join(dir, "blocked")
+	if err := ioutil.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sink := &DirSink{Dir: dir}
+	err = sink.WriteFile(filepath.Join("blocked", "main.cpp"), []byte("int main() {}"))
+	var writeErr *WriteError
+	if !errors.As(err, &writeErr) {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	if writeErr.Path != blocked {
+		t.Errorf("got path %q, expected %q", writeErr.Path, blocked)
+	}
+
+	if err := (&DirSink{Dir: blocked}).Prepare(true); err == nil {
+		t.Error("expected error preparing output over a file")
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"contests":                "contests",
+		"out,format=dir":          "out",
+		"/tmp/out/,format=dir":    "/tmp/out/",
+		"out,format=csv":          "",
+		"out,compress=gzip":       "",
+		"out,format":              "",
+		",format=dir":             "",
+		"out,format=dir,format=x": "",
+	} {
+		got, err := parseOutput(raw)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("parseOutput(%q): expected error, got %q", raw, got)
+			}
+			continue
+		}
+		if err != nil || got != expected {
+			t.Errorf("parseOutput(%q) = %q, %v, expected %q", raw, got, err, expected)
+		}
+	}
+}
+
+func TestWriteDataSinks(t *testing.T) {
+	stubPdf(t)
+	p, srv := newSelfTestParser(t)
+	p.RunsCSV = true
+	p.runColumns = strings.Split(defaultRunColumns, ",")
+	for path, emit := range map[string]Emitter{
+		"/summary":     &p.ProblemsEmitter,
+		"/submissions": &p.SubmissionsEmitter,
+		"/standings":   &p.StandingsEmitter,
+	} {
+		u, _ := url.Parse(srv.URL + path)
+		if err := p.Do(context.Background(), u, emit); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := setSourcePaths(mustSourceName(t, defaultSourceName), p.Submissions); err != nil {
+		t.Fatal(err)
+	}
+
+	sinks := []memSink{make(memSink), make(memSink)}
+	for _, sink := range sinks {
+		if err := p.WriteData(sink); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(sinks[0], sinks[1]) {
+		t.Errorf("outputs differ: %q and %q", names(sinks[0]), names(sinks[1]))
+	}
+	for _, name := range []string{"standings.pdf", "summary.pdf", "runs.csv", "problems.json", filepath.Join("A", "main.cpp"), filepath.Join("B", "main.py")} {
+		if _, ok := sinks[1][name]; !ok {
+			t.Errorf("%s not written, got %q", name, names(sinks[1]))
+		}
+	}
+}
+
+func names(sink memSink) []string {
+	res := make([]string, 0, len(sink))
+	for name := range sink {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
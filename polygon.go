@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const polygonLanguage = "english"
+
+type polygonProblem struct {
+	XMLName    xml.Name           `xml:"problem"`
+	ShortName  string             `xml:"short-name,attr"`
+	Revision   int                `xml:"revision,attr"`
+	Names      []polygonName      `xml:"names>name"`
+	Statements []polygonStatement `xml:"statements>statement"`
+	Testset    polygonTestset     `xml:"judging>testset"`
+}
+
+type polygonName struct {
+	Language string `xml:"language,attr"`
+	Value    string `xml:"value,attr"`
+}
+
+type polygonStatement struct {
+	Charset  string `xml:"charset,attr"`
+	Language string `xml:"language,attr"`
+	Path     string `xml:"path,attr"`
+	Type     string `xml:"type,attr"`
+}
+
+type polygonTestset struct {
+	Name          string        `xml:"name,attr"`
+	TestCount     int           `xml:"test-count"`
+	InputPattern  string        `xml:"input-path-pattern"`
+	AnswerPattern string        `xml:"answer-path-pattern"`
+	Tests         []polygonTest `xml:"tests>test"`
+}
+
+type polygonTest struct {
+	Method string `xml:"method,attr"`
+	Sample bool   `xml:"sample,attr"`
+}
+
+// writePolygonPackage writes a minimal Polygon package of the problem: problem.xml, html statement and sample tests.
+// Checker, validator and hidden tests are not available from the contest pages.
+func writePolygonPackage(sink OutputSink, dir string, problem *Problem) error {
+	statementPath := filepath.Join("statements", ".html", polygonLanguage, "problem.html")
+
+	desc := polygonProblem{
+		ShortName: strings.ToLower(problem.ID),
+		Revision:  1,
+		Names:     []polygonName{{Language: polygonLanguage, Value: problem.Name}},
+		Testset: polygonTestset{
+			Name:          "tests",
+			TestCount:     len(problem.Samples),
+			InputPattern:  "tests/%02d",
+			AnswerPattern: "tests/%02d.a",
+		},
+	}
+	if problem.Statement != "" {
+		desc.Statements = append(desc.Statements, polygonStatement{
+			Charset:  "UTF-8",
+			Language: polygonLanguage,
+			Path:     filepath.ToSlash(statementPath),
+			Type:     "text/html",
+		})
+	}
+
+	files := make(map[string][]byte)
+	for idx, sample := range problem.Samples {
+		desc.Testset.Tests = append(desc.Testset.Tests, polygonTest{Method: "manual", Sample: true})
+		name := filepath.Join("tests", fmt.Sprintf("%02d", idx+1))
+		files[name] = []byte(sample.Input)
+		files[name+".a"] = []byte(sample.Output)
+	}
+	if problem.Statement != "" {
+		files[statementPath] = []byte(problem.Statement)
+	}
+
+	raw, err := xml.MarshalIndent(desc, "", "    ")
+	if err != nil {
+		return fmt.Errorf("encode problem.xml: %w", err)
+	}
+	files["problem.xml"] = append([]byte(xml.Header), raw...)
+
+	for name, data := range files {
+		if err := sink.WriteFile(filepath.Join(dir, name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestWritePolygonPackage(t *testing.T) {
+	problem := &Problem{
+		ID:        "A",
+		Name:      "Sum",
+		Statement: "<html><body>Add two numbers</body></html>",
+		Samples:   []SampleTest{{Input: "1 2\n", Output: "3\n"}, {Input: "2 2\n", Output: "4\n"}},
+	}
+	sink := make(memSink)
+	if err := writePolygonPackage(sink, "polygon/A", problem); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for name := range sink {
+		names = append(names, filepath.ToSlash(name))
+	}
+	sort.Strings(names)
+	expected := []string{
+		"polygon/A/problem.xml",
+		"polygon/A/statements/.html/english/problem.html",
+		"polygon/A/tests/01",
+		"polygon/A/tests/01.a",
+		"polygon/A/tests/02",
+		"polygon/A/tests/02.a",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("got files %q, expected %q", names, expected)
+	}
+	for idx := range names {
+		if names[idx] != expected[idx] {
+			t.Errorf("got file %q, expected %q", names[idx], expected[idx])
+		}
+	}
+	if got := string(sink[filepath.Join("polygon/A", "tests", "02.a")]); got != "4\n" {
+		t.Errorf("answer of test 2: got %q", got)
+	}
+
+	var desc polygonProblem
+	if err := xml.Unmarshal(sink[filepath.Join("polygon/A", "problem.xml")], &desc); err != nil {
+		t.Fatalf("decode problem.xml: %v", err)
+	}
+	if desc.ShortName != "a" || desc.Testset.TestCount != 2 || len(desc.Testset.Tests) != 2 || !desc.Testset.Tests[0].Sample {
+		t.Errorf("unexpected problem.xml %+v", desc)
+	}
+	if len(desc.Statements) != 1 || desc.Statements[0].Path != "statements/.html/english/problem.html" {
+		t.Errorf("unexpected statements %+v", desc.Statements)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// CheckPages requests every contest page found by HrefEmitter and reports all unreachable ones at once.
+func (p *Parser) CheckPages(ctx context.Context) error {
+	var errs error
+	for _, page := range []struct {
+		name string
+		u    *url.URL
+	}{
+		{"summary", p.SummaryHref},
+		{"submissions", p.SubmissionsHref},
+		{"standings", p.StandingsHref},
+		{"statements", p.StatementsHref},
+	} {
+		if page.u == nil {
+			continue
+		}
+		if err := p.checkPage(ctx, page.u); err != nil {
+			log.Warn("preflight", zap.String("page", page.name), zap.Stringer("url", page.u), zap.Error(err))
+			errs = multierr.Append(errs, fmt.Errorf("%s: %w", page.name, err))
+			continue
+		}
+		log.Debug("preflight", zap.String("page", page.name), zap.Stringer("url", page.u))
+	}
+	if errs != nil {
+		return fmt.Errorf("preflight: %d pages unreachable: %w", len(multierr.Errors(errs)), errs)
+	}
+	return nil
+}
+
+func (p *Parser) checkPage(ctx context.Context, u *url.URL) error {
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := p.submitForm(cctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckPages(t *testing.T) {
+	var missing atomic.Value
+	missing.Store(map[string]int{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := missing.Load().(map[string]int)[r.URL.Path]; ok {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		selfTestHandler(w, r)
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	p.Preflight = true
+	if err := p.GetData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	missing.Store(map[string]int{"/standings": http.StatusNotFound})
+	p = newTestParser(t, srv.URL+"/team.cgi")
+	p.Preflight = true
+	err := p.GetData(context.Background())
+	if err == nil {
+		t.Fatal("expected preflight error")
+	}
+	if !strings.Contains(err.Error(), "1 pages unreachable") || !strings.Contains(err.Error(), "standings:") {
+		t.Errorf("error %q does not report standings", err)
+	}
+	// only the failing page is reported
+	for _, page := range []string{"summary:", "submissions:", "statements:"} {
+		if strings.Contains(err.Error(), page) {
+			t.Errorf("error %q reports reachable page %q", err, page)
+		}
+	}
+	// pages are not scraped after the failed check
+	if len(p.Problems) != 0 {
+		t.Errorf("got %d problems, expected none", len(p.Problems))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// pathVariants returns the path itself followed by known spellings of the ejudge client endpoint, without repeats.
+func pathVariants(p string) []string {
+	dir, file := path.Split(p)
+	candidates := []string{p, strings.ToLower(p)}
+	if !strings.HasSuffix(p, "/") {
+		candidates = append(candidates, p+"/")
+	}
+	for _, name := range []string{"team.cgi", "team", "team/", "new-client", "client"} {
+		if name != file {
+			candidates = append(candidates, dir+name)
+		}
+	}
+
+	seen := make(map[string]bool, len(candidates))
+	variants := candidates[:0]
+	for _, variant := range candidates {
+		if !seen[variant] {
+			seen[variant] = true
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// probePath replaces the path of u with the first variant that does not respond with 404.
+func (p *Parser) probePath(ctx context.Context, u *url.URL) (*url.URL, error) {
+	for _, variant := range pathVariants(u.Path) {
+		candidate := *u
+		candidate.Path = variant
+		q := candidate.Query()
+		q.Set("contest_id", strconv.Itoa(p.ContestID))
+		candidate.RawQuery = q.Encode()
+
+		resp, err := p.submitForm(ctx, http.MethodGet, &candidate, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			log.Debug("probe path", zap.String("path", variant), zap.Int("code", resp.StatusCode))
+			continue
+		}
+
+		candidate.RawQuery = u.RawQuery
+		if variant != u.Path {
+			log.Info("found contest path", zap.Stringer("url", &candidate))
+		}
+		return &candidate, nil
+	}
+	return nil, fmt.Errorf("no path variant of %q found", u.Path)
+}
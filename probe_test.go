@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPathVariants(t *testing.T) {
+	for p, expected := range map[string][]string{
+		"/cgi-bin/Team.cgi": {
+			"/cgi-bin/Team.cgi", "/cgi-bin/team.cgi", "/cgi-bin/Team.cgi/",
+			"/cgi-bin/team", "/cgi-bin/team/", "/cgi-bin/new-client", "/cgi-bin/client",
+		},
+		"/cgi-bin/team": {
+			"/cgi-bin/team", "/cgi-bin/team/", "/cgi-bin/team.cgi", "/cgi-bin/new-client", "/cgi-bin/client",
+		},
+	} {
+		if got := pathVariants(p); !reflect.DeepEqual(got, expected) {
+			t.Errorf("pathVariants(%q) = %q, expected %q", p, got, expected)
+		}
+	}
+}
+
+func TestProbePath(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ejudge/new-client" || r.URL.Query().Get("contest_id") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL)
+	u, _ := url.Parse(srv.URL + "/ejudge/Team.cgi?locale_id=1")
+	found, err := p.probePath(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Path != "/ejudge/new-client" || found.RawQuery != "locale_id=1" {
+		t.Errorf("got %s", found)
+	}
+
+	u, _ = url.Parse(srv.URL + "/missing/team.cgi")
+	if _, err := p.probePath(context.Background(), u); err == nil {
+		t.Error("expected error when no variant exists")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ProgressFunc reports the number of bytes read so far, total is -1 if the size is unknown.
+type ProgressFunc func(read, total int64)
+
+const (
+	readChunkSize    = 32 << 10
+	progressInterval = 500 * time.Millisecond
+)
+
+// readLimited reads r in chunks and fails as soon as more than limit bytes are read, limit <= 0 disables the check.
+// Progress is reported at most once per progressInterval and once after the body is read.
+func readLimited(r io.Reader, total, limit int64, progress ProgressFunc) ([]byte, error) {
+	if limit > 0 && total > limit {
+		return nil, fmt.Errorf("file size %d exceeds limit %d", total, limit)
+	}
+
+	// without the limit the declared size is not trusted for preallocation
+	size := total
+	if limit <= 0 && size > readChunkSize {
+		size = readChunkSize
+	}
+	var raw []byte
+	if size > 0 {
+		raw = make([]byte, 0, size)
+	}
+	chunk := make([]byte, readChunkSize)
+	last := time.Now()
+	for {
+		n, err := r.Read(chunk)
+		raw = append(raw, chunk[:n]...)
+		if limit > 0 && int64(len(raw)) > limit {
+			return nil, fmt.Errorf("file size exceeds limit %d", limit)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if progress != nil && time.Since(last) >= progressInterval {
+			last = time.Now()
+			progress(int64(len(raw)), total)
+		}
+	}
+	if progress != nil {
+		progress(int64(len(raw)), total)
+	}
+	return raw, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// zeroReader is an endless stream.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for idx := range p {
+		p[idx] = 0
+	}
+	return len(p), nil
+}
+
+func TestReadLimited(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 3*readChunkSize+5)
+	var calls [][2]int64
+	raw, err := readLimited(bytes.NewReader(body), int64(len(body)), 0, func(read, total int64) {
+		calls = append(calls, [2]int64{read, total})
+	})
+	if err != nil || !bytes.Equal(raw, body) {
+		t.Fatalf("got %d bytes, %v", len(raw), err)
+	}
+	if len(calls) == 0 || calls[len(calls)-1] != [2]int64{int64(len(body)), int64(len(body))} {
+		t.Errorf("got progress %v", calls)
+	}
+
+	if _, err := readLimited(bytes.NewReader(body), int64(len(body)), 100, nil); err == nil {
+		t.Error("expected error on declared size over limit")
+	}
+	// huge declared size is not preallocated without the limit
+	raw, err = readLimited(strings.NewReader("abc"), 1<<50, 0, nil)
+	if err != nil || string(raw) != "abc" || cap(raw) > readChunkSize {
+		t.Errorf("got %q with capacity %d, %v", raw, cap(raw), err)
+	}
+	// the stream without size is stopped as soon as the limit is exceeded
+	if _, err := readLimited(zeroReader{}, -1, 4*readChunkSize, nil); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("expected limit error, got %v", err)
+	}
+}
+
+func TestSourceProgress(t *testing.T) {
+	source := strings.Repeat("// line\n", readChunkSize)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		// flushing before the body is written makes the response chunked, without Content-Length
+		w.(http.Flusher).Flush()
+		w.Write([]byte(source))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	var read, total int64
+	se := &SubmissionsEmitter{cli: srv.Client(), maxSize: 1 << 20, progress: func(_ *url.URL, r, t int64) {
+		read, total = r, t
+	}}
+	submission := &Submission{RunID: 1, sourceHref: u}
+	if err := se.loadSource(context.Background(), []*Submission{submission}); err != nil {
+		t.Fatal(err)
+	}
+	if string(submission.Source) != source {
+		t.Errorf("got %d bytes of source", len(submission.Source))
+	}
+	if read != int64(len(source)) || total != -1 {
+		t.Errorf("got progress %d of %d", read, total)
+	}
+
+	se.maxSize = 1024
+	if err := se.loadSource(context.Background(), []*Submission{{RunID: 2, sourceHref: u}}); err == nil {
+		t.Error("expected error on source over max size")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+// loadFieldNames reads json object mapping output field names to new ones.
+func loadFieldNames(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string)
+	if err := json.Unmarshal(raw, &names); err != nil {
+		return nil, fmt.Errorf("decode field names: %q: %w", path, err)
+	}
+
+	targets := make(map[string]string, len(names))
+	for from, to := range names {
+		if to == "" {
+			return nil, fmt.Errorf("empty new name of field %q", from)
+		}
+		if prev, ok := targets[to]; ok {
+			return nil, fmt.Errorf("fields %q and %q are both renamed to %q", prev, from, to)
+		}
+		targets[to] = from
+	}
+	return names, nil
+}
+
+// renameFields marshals v with struct field names changed according to names. Keys of maps are data, e.g. problem
+// ids, and are kept as is.
+func renameFields(v interface{}, names map[string]string) ([]byte, error) {
+	doc, err := renameValue(reflect.ValueOf(v), names)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "\t")
+}
+
+// renamedObject is a struct with renamed fields, fields are written in the declaration order.
+type renamedObject struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *renamedObject) add(key string, value interface{}) error {
+	for _, prev := range o.keys {
+		if prev == key {
+			return fmt.Errorf("renamed field %q collides with existing one", key)
+		}
+	}
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+	return nil
+}
+
+func (o *renamedObject) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for idx, key := range o.keys {
+		if idx != 0 {
+			buf.WriteByte(',')
+		}
+		rawKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		rawValue, err := json.Marshal(o.values[idx])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(rawKey)
+		buf.WriteByte(':')
+		buf.Write(rawValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func renameValue(v reflect.Value, names map[string]string) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	// values with own encoding, e.g. time.Time, are written as is
+	if v.Type().Implements(marshalerType) {
+		return v.Interface(), nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return renameValue(v.Elem(), names)
+	case reflect.Struct:
+		obj := new(renamedObject)
+		if err := renameStruct(obj, v, names); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value, err := renameValue(iter.Value(), names)
+			if err != nil {
+				return nil, err
+			}
+			res[fmt.Sprint(iter.Key().Interface())] = value
+		}
+		return res, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return v.Interface(), nil
+		}
+		res := make([]interface{}, v.Len())
+		for idx := range res {
+			value, err := renameValue(v.Index(idx), names)
+			if err != nil {
+				return nil, err
+			}
+			res[idx] = value
+		}
+		return res, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+// renameStruct adds exported fields of v to obj following encoding/json rules for tags and embedded structs.
+func renameStruct(obj *renamedObject, v reflect.Value, names map[string]string) error {
+	t := v.Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma+1:]
+		}
+		value := v.Field(idx)
+		if field.Anonymous && name == "" && value.Kind() == reflect.Struct {
+			if err := renameStruct(obj, value, names); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && emptyValue(value) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if renamed, ok := names[name]; ok {
+			name = renamed
+		}
+		renamed, err := renameValue(value, names)
+		if err != nil {
+			return err
+		}
+		if err := obj.add(name, renamed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyValue reports if the value is omitted by omitempty.
+func emptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+// writeOutputJSON writes v to the output with field names changed by -rename-fields.
+func (p *Parser) writeOutputJSON(sink OutputSink, name string, v interface{}) error {
+	if p.fieldNames == nil {
+		return writeJSON(sink, name, v)
+	}
+	raw, err := renameFields(v, p.fieldNames)
+	if err != nil {
+		return fmt.Errorf("rename fields of %q: %w", name, err)
+	}
+	return sink.WriteFile(name, raw)
+}
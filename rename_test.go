@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFieldNames(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "valid", raw: `{"RunID": "run_id", "ProblemID": "problem"}`},
+		{name: "bad json", raw: `{"RunID": 1}`, wantErr: true},
+		{name: "empty name", raw: `{"RunID": ""}`, wantErr: true},
+		{name: "same target", raw: `{"RunID": "id", "ProblemID": "id"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := ioutil.WriteFile(path, []byte(tt.raw), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			names, err := loadFieldNames(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if !tt.wantErr && names["RunID"] != "run_id" {
+				t.Errorf("got names %v", names)
+			}
+		})
+	}
+	if _, err := loadFieldNames(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error on missing file")
+	}
+}
+
+func TestRenameFields(t *testing.T) {
+	type run struct {
+		RunID int64
+		Tags  []string `json:",omitempty"`
+		Note  string   `json:"note,omitempty"`
+		path  string
+	}
+	doc := struct {
+		ID      string
+		Runs    []run
+		History map[string][]run
+		Skipped string `json:"-"`
+		When    time.Time
+	}{
+		ID:      "A",
+		Runs:    []run{{RunID: 12345678901234567, Note: "x", path: "A/main.cpp"}},
+		History: map[string][]run{"ID": {{RunID: 1}}},
+		Skipped: "hidden",
+		When:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	names := map[string]string{"RunID": "run_id", "ID": "id", "note": "comment"}
+	raw, err := renameFields(doc, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// struct fields are renamed in declaration order, map keys are data and are kept
+	expected := `{
+	"id": "A",
+	"Runs": [
+		{
+			"run_id": 12345678901234567,
+			"comment": "x"
+		}
+	],
+	"History": {
+		"ID": [
+			{
+				"run_id": 1
+			}
+		]
+	},
+	"When": "2026-01-02T03:04:05Z"
+}`
+	if string(raw) != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", raw, expected)
+	}
+
+	collision := struct {
+		ID string
+		Id string `json:"id"`
+	}{"A", "B"}
+	if _, err := renameFields(collision, names); err == nil {
+		t.Error("expected error on colliding fields")
+	}
+}
+
+func TestWriteRenamedFields(t *testing.T) {
+	stubPdf(t)
+	p := &Parser{WriteHistory: true, fieldNames: map[string]string{"ID": "id", "Name": "title", "A": "B", "RunID": "run"}}
+	p.Problems = []*Problem{{ID: "A", Name: "Sum"}}
+	p.Runs = []*Submission{{RunID: 1, ProblemID: "A", Result: "OK", OK: true}}
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+	var problems []map[string]interface{}
+	if err := json.Unmarshal(sink["problems.json"], &problems); err != nil {
+		t.Fatalf("decode problems.json: %v", err)
+	}
+	if len(problems) != 1 || problems[0]["id"] != "A" || problems[0]["title"] != "Sum" {
+		t.Errorf("got problems %v", problems)
+	}
+	if _, ok := problems[0]["ID"]; ok {
+		t.Error("field ID is not renamed")
+	}
+
+	// problem ids are keys of the history map, not field names
+	var history struct {
+		History map[string][]map[string]interface{}
+	}
+	if err := json.Unmarshal(sink["history.json"], &history); err != nil {
+		t.Fatalf("decode history.json: %v", err)
+	}
+	if events := history.History["A"]; len(events) != 1 || events[0]["run"] != float64(1) {
+		t.Errorf("got history %v", history.History)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const markdownReport = `# {{ if .Title }}{{ cell .Title }}{{ else }}Contest report{{ end }}
+
+## Problems
+
+| Problem | Name | Tags | Solved | Languages |
+|---|---|---|---|---|
+{{ range .Problems -}}
+| {{ cell .ID }} | {{ cell .Name }} | {{ cell (join .Tags ", ") }} | {{ if .OK }}yes{{ else }}no{{ end }} | {{ cell (join .SolvedLanguages ", ") }} |
+{{ end }}
+## Submissions
+
+| Run ID | Time | Problem | Language | Result |
+|---|---|---|---|---|
+{{ range .Submissions -}}
+| {{ .RunID }} | {{ cell .Time }} | {{ cell .ProblemID }} | {{ cell .Language }} | {{ cell .Result }} |
+{{ end }}
+{{- range .Submissions }}{{ if and .OK .Source }}
+### {{ .ProblemID }} (run {{ .RunID }})
+
+{{ code .Language .Source }}
+{{ end }}{{ end }}`
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"cell": markdownCell,
+	"join": strings.Join,
+	"code": markdownCode,
+}).Parse(markdownReport))
+
+// markdownCell makes text safe to be put in a table cell.
+func markdownCell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// markdownCode wraps source in a fence longer than any backtick run inside it.
+func markdownCode(lang string, source []byte) string {
+	fence := "```"
+	for strings.Contains(string(source), fence) {
+		fence += "`"
+	}
+	text := strings.TrimRight(string(source), "\n")
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, languageHint(lang), text, fence)
+}
+
+// languageHint is the fenced code block language of ejudge compiler name.
+func languageHint(lang string) string {
+	switch {
+	case strings.Contains(lang, "g++"):
+		return "cpp"
+	case strings.Contains(lang, "gcc"):
+		return "c"
+	case strings.Contains(lang, "python"):
+		return "python"
+	case strings.Contains(lang, "fpc"):
+		return "pascal"
+	default:
+		return ""
+	}
+}
+
+// MarkdownReport renders problems and submissions as a markdown document.
+func MarkdownReport(title string, problems []*Problem, submissions []*Submission) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := reportTemplate.Execute(buf, struct {
+		Title       string
+		Problems    []*Problem
+		Submissions []*Submission
+	}{title, problems, submissions})
+	if err != nil {
+		return nil, fmt.Errorf("render report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownReportTags(t *testing.T) {
+	problems := []*Problem{{ID: "A", Name: "Sum", OK: true, Tags: []string{"math", "greedy"}}}
+	raw, err := MarkdownReport("Contest", problems, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := "| A | Sum | math, greedy | yes |  |"; !strings.Contains(string(raw), row) {
+		t.Errorf("row %q not found in report:\n%s", row, raw)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestMarkdownReportGolden(t *testing.T) {
+	problems := []*Problem{
+		{ID: "A", Name: "A | B", OK: true, Tags: []string{"math"}, SolvedLanguages: []string{"g++", "python3"}},
+		{ID: "B", Name: "Strings\nwith newline"},
+	}
+	submissions := []*Submission{
+		{RunID: 3, Time: "00:30:00", ProblemID: "A", Language: "g++", Result: "OK", OK: true,
+			Source: []byte("// ```fence```\nint main() { return 0; }\n")},
+		{RunID: 2, Time: "00:20:00", ProblemID: "B", Language: "python3", Result: "Wrong answer", Source: []byte("print(1)\n")},
+	}
+	raw, err := MarkdownReport("Self test", problems, submissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "report.md")
+	if *update {
+		if err := ioutil.WriteFile(golden, raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != string(expected) {
+		t.Errorf("report differs from %s:\n%s", golden, raw)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultRetryOn = "429,500,502,503,504,timeout,reset"
+
+// retryPolicy decides which failed requests are repeated.
+type retryPolicy struct {
+	statuses map[int]bool
+	timeout  bool
+	reset    bool
+}
+
+// parseRetryOn parses comma separated list of status codes and network error kinds (timeout, reset).
+func parseRetryOn(raw string) (*retryPolicy, error) {
+	policy := &retryPolicy{statuses: make(map[int]bool)}
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch item {
+		case "":
+		case "timeout":
+			policy.timeout = true
+		case "reset":
+			policy.reset = true
+		default:
+			code, err := strconv.Atoi(item)
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("invalid retry condition %q", item)
+			}
+			policy.statuses[code] = true
+		}
+	}
+	return policy, nil
+}
+
+func (rp *retryPolicy) retryable(resp *http.Response, err error) bool {
+	if err == nil {
+		return rp.statuses[resp.StatusCode]
+	}
+	var netErr net.Error
+	if rp.timeout && errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return rp.reset && errors.Is(err, syscall.ECONNRESET)
+}
+
+// retryTransport repeats requests failed with retryable errors.
+type retryTransport struct {
+	next    http.RoundTripper
+	policy  *retryPolicy
+	retries int
+	backoff time.Duration
+}
+
+// idempotent reports if the request may be sent again. Forms submitted with POST, e.g. login, are sent once.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody
+	default:
+		return false
+	}
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := rt.next.RoundTrip(req)
+		if attempt >= rt.retries || !idempotent(req) || !rt.policy.retryable(resp, err) {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
+			log.Warn("retry request", zap.Stringer("url", req.URL), zap.Int("code", resp.StatusCode), zap.Int("attempt", attempt+1))
+		} else {
+			log.Warn("retry request", zap.Stringer("url", req.URL), zap.Error(err), zap.Int("attempt", attempt+1))
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(rt.backoff * time.Duration(attempt+1)):
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// countingServer responds with status to every request and counts requests by method.
+func countingServer(status int) (*httptest.Server, map[string]*int32) {
+	counts := map[string]*int32{http.MethodGet: new(int32), http.MethodPost: new(int32)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count, ok := counts[r.Method]; ok {
+			atomic.AddInt32(count, 1)
+		}
+		w.WriteHeader(status)
+	}))
+	return srv, counts
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	srv, counts := countingServer(http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL)
+	p.cli.Transport.(*retryTransport).retries = 2
+	p.cli.Transport.(*retryTransport).backoff = 0
+
+	u, _ := url.Parse(srv.URL)
+	resp, err := p.submitForm(context.Background(), http.MethodPost, u, url.Values{"login": {"selftest"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(counts[http.MethodPost]); got != 1 {
+		t.Errorf("POST sent %d times, expected once", got)
+	}
+
+	resp, err = p.cli.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(counts[http.MethodGet]); got != 3 {
+		t.Errorf("GET sent %d times, expected 3", got)
+	}
+}
+
+func TestLoginOnce(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		ok       bool
+	}{
+		{"selftest", true},
+		{"wrong", false},
+	} {
+		var logins int32
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Write([]byte(selfTestPages["/team.cgi"]))
+				return
+			}
+			atomic.AddInt32(&logins, 1)
+			// keep the login in flight until every caller waits for it
+			<-release
+			r.ParseForm()
+			if r.PostForm.Get("password") != "selftest" {
+				w.Write([]byte(`<html><body><p class="server_error">Invalid login or password</p></body></html>`))
+				return
+			}
+			w.Write([]byte(contestPage))
+		}))
+
+		p := newTestParser(t, srv.URL+"/team.cgi")
+		p.Password = tc.password
+		var (
+			wg   sync.WaitGroup
+			urls = make([]string, 8)
+			errs = make([]error, 8)
+		)
+		for idx := range urls {
+			wg.Add(1)
+			go func(idx int) {
+				defer wg.Done()
+				u, err := p.login(context.Background())
+				if err == nil {
+					urls[idx] = u.String()
+				}
+				errs[idx] = err
+			}(idx)
+		}
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		for idx, err := range errs {
+			if tc.ok && err != nil {
+				t.Fatalf("login %d: %v", idx, err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("login %d with %q: expected error", idx, tc.password)
+			}
+			if tc.ok && !strings.HasSuffix(urls[idx], "/summary?SID=1") {
+				t.Errorf("login %d: got url %q", idx, urls[idx])
+			}
+		}
+		if got := atomic.LoadInt32(&logins); got != 1 {
+			t.Errorf("password %q: credentials submitted %d times, expected once", tc.password, got)
+		}
+		// the failed login is not cached
+		if !tc.ok {
+			if _, err := p.login(context.Background()); err == nil {
+				t.Error("expected error on next login")
+			}
+			if got := atomic.LoadInt32(&logins); got != 2 {
+				t.Errorf("got %d logins after retry, expected 2", got)
+			}
+		}
+		srv.Close()
+	}
+}
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryPolicy(t *testing.T) {
+	policy, err := parseRetryOn(defaultRetryOn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset := &url.Error{Op: "Get", URL: "http://h", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}
+	for _, tc := range []struct {
+		name     string
+		resp     *http.Response
+		err      error
+		expected bool
+	}{
+		{"503", &http.Response{StatusCode: http.StatusServiceUnavailable}, nil, true},
+		{"429", &http.Response{StatusCode: http.StatusTooManyRequests}, nil, true},
+		{"404", &http.Response{StatusCode: http.StatusNotFound}, nil, false},
+		{"200", &http.Response{StatusCode: http.StatusOK}, nil, false},
+		{"timeout", nil, &url.Error{Op: "Get", URL: "http://h", Err: timeoutError{}}, true},
+		{"reset", nil, reset, true},
+		{"refused", nil, syscall.ECONNREFUSED, false},
+	} {
+		if got := policy.retryable(tc.resp, tc.err); got != tc.expected {
+			t.Errorf("%s: got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+
+	policy, err = parseRetryOn(" 404 , reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.retryable(&http.Response{StatusCode: http.StatusNotFound}, nil) || policy.retryable(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil) {
+		t.Error("custom status list is not applied")
+	}
+	if policy.retryable(nil, &url.Error{Op: "Get", URL: "http://h", Err: timeoutError{}}) {
+		t.Error("timeout retried without timeout condition")
+	}
+
+	for _, bad := range []string{"5xx", "42", "600", "refused"} {
+		if _, err := parseRetryOn(bad); err == nil {
+			t.Errorf("parseRetryOn(%q): expected error", bad)
+		}
+	}
+}
+
+func TestRetryTransportStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status   int
+		expected int32
+	}{
+		{http.StatusServiceUnavailable, 3},
+		{http.StatusNotFound, 1},
+	} {
+		srv, counts := countingServer(tc.status)
+		p := newTestParser(t, srv.URL)
+		p.cli.Transport.(*retryTransport).retries = 2
+		p.cli.Transport.(*retryTransport).backoff = 0
+
+		resp, err := p.cli.Get(srv.URL)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%d: got status %d", tc.status, resp.StatusCode)
+		}
+		if got := atomic.LoadInt32(counts[http.MethodGet]); got != tc.expected {
+			t.Errorf("%d: sent %d times, expected %d", tc.status, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// parseRoles parses comma separated ejudge role ids, e.g. 0 for contestant and 6 for judge.
+func parseRoles(raw string) ([]int, error) {
+	var roles []int
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		role, err := strconv.Atoi(item)
+		if err != nil || role < 0 {
+			return nil, fmt.Errorf("invalid role %q", item)
+		}
+		roles = append(roles, role)
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("no roles in %q", raw)
+	}
+	return roles, nil
+}
+
+// RunRoles runs the parser once per role with a separate session, output of a role goes to role-N subdirectory.
+// Failure of one role does not stop the others.
+func (p *Parser) RunRoles(ctx context.Context, roles []int) error {
+	outputs := p.Outputs
+	defer func() {
+		p.Outputs = outputs
+		p.Output = outputs[0]
+	}()
+
+	var errs error
+	for _, role := range roles {
+		if err := p.resetSession(true); err != nil {
+			return err
+		}
+		p.Role = role
+		p.Emitters = Emitters{}
+		p.state = nil
+		p.Outputs = make(stringsFlag, 0, len(outputs))
+		for _, out := range outputs {
+			p.Outputs = append(p.Outputs, filepath.Join(out, "role-"+strconv.Itoa(role)))
+		}
+		p.Output = p.Outputs[0]
+
+		log.Info("run role", zap.Int("role", role))
+		if err := p.Run(ctx); err != nil {
+			log.Error("run role", zap.Int("role", role), zap.Error(err))
+			errs = multierr.Append(errs, fmt.Errorf("role %d: %w", role, err))
+		}
+	}
+	return errs
+}
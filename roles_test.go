@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRoles(t *testing.T) {
+	roles, err := parseRoles(" 0, 6 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(roles, []int{0, 6}) {
+		t.Errorf("got %v", roles)
+	}
+	for _, bad := range []string{"", " , ", "judge", "-1"} {
+		if _, err := parseRoles(bad); err == nil {
+			t.Errorf("parseRoles(%q): expected error", bad)
+		}
+	}
+}
+
+func TestRunRoles(t *testing.T) {
+	stubPdf(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.FormValue("role") != "0" {
+			w.Write([]byte(`<html><body><div class="server_error">Permission denied</div></body></html>`))
+			return
+		}
+		selfTestHandler(w, r)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := newTestParser(t, srv.URL+"/team.cgi")
+	p.Outputs = stringsFlag{dir}
+	p.Output = dir
+	err = p.RunRoles(context.Background(), []int{0, 6})
+	if err == nil || !strings.Contains(err.Error(), "role 6") || strings.Contains(err.Error(), "role 0") {
+		t.Errorf("expected error of role 6 only, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "role-0", "A", "main.cpp")); err != nil {
+		t.Errorf("output of role 0: %v", err)
+	}
+	if !reflect.DeepEqual(p.Outputs, stringsFlag{dir}) || p.Output != dir {
+		t.Errorf("outputs are not restored: %q, %q", p.Outputs, p.Output)
+	}
+}
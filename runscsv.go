@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultRunColumns = "run_id,time,problem,language,verdict,size,time_used,memory_used"
+	// optionalRunColumns are written only if selected with -runs-csv-columns.
+	optionalRunColumns = "tests_passed,tests_total"
+)
+
+// runColumns maps csv column names to run fields. Unknown values are written as empty cells.
+var runColumns = map[string]func(*Submission) string{
+	"run_id":   func(s *Submission) string { return strconv.Itoa(s.RunID) },
+	"time":     func(s *Submission) string { return s.Time },
+	"problem":  func(s *Submission) string { return s.ProblemID },
+	"language": func(s *Submission) string { return s.Language },
+	"verdict":  func(s *Submission) string { return s.Result },
+	"size": func(s *Submission) string {
+		// only sources of fetched runs are known
+		if s.Source == nil {
+			return ""
+		}
+		return strconv.Itoa(len(s.Source))
+	},
+	"time_used":   func(s *Submission) string { return positiveInt(s.MaxTimeMS) },
+	"memory_used": func(s *Submission) string { return positiveInt(s.MaxMemoryKB) },
+	"tests_passed": func(s *Submission) string {
+		// zero passed tests are written only if the total is known
+		if s.TestsTotal == 0 {
+			return ""
+		}
+		return strconv.Itoa(s.TestsPassed)
+	},
+	"tests_total": func(s *Submission) string { return positiveInt(s.TestsTotal) },
+}
+
+func positiveInt(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// parseRunColumns splits comma separated list of csv columns.
+func parseRunColumns(raw string) ([]string, error) {
+	var columns []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := runColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown csv column %q (available: %s)", name, defaultRunColumns+","+optionalRunColumns)
+		}
+		columns = append(columns, name)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no csv columns selected")
+	}
+	return columns, nil
+}
+
+// RunsCSV formats runs as csv table with header row.
+func RunsCSV(runs []*Submission, columns []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(columns))
+	for _, run := range runs {
+		for idx, name := range columns {
+			record[idx] = runColumns[name](run)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
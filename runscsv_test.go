@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestRunsCSV(t *testing.T) {
+	runs := []*Submission{
+		{RunID: 2, Time: "00:20:00", ProblemID: "B", Language: "python3", Result: "Wrong answer, test 3", MaxTimeMS: 15},
+		{RunID: 1, Time: "00:10:00", ProblemID: "A", Language: "g++", Result: "OK", Source: []byte("int main() {}"), MaxMemoryKB: 1024},
+	}
+	columns, err := parseRunColumns(defaultRunColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := RunsCSV(runs, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `run_id,time,problem,language,verdict,size,time_used,memory_used
+2,00:20:00,B,python3,"Wrong answer, test 3",,15,
+1,00:10:00,A,g++,OK,13,,1024
+`
+	if string(raw) != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", raw, expected)
+	}
+
+	columns, err = parseRunColumns(" problem , ,run_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := RunsCSV(runs[:1], columns); string(raw) != "problem,run_id\nB,2\n" {
+		t.Errorf("selected columns: got %q", raw)
+	}
+
+	for _, bad := range []string{"run_id,author", " , "} {
+		if _, err := parseRunColumns(bad); err == nil {
+			t.Errorf("parseRunColumns(%q): expected error", bad)
+		}
+	}
+}
+
+func TestRunsCSVTests(t *testing.T) {
+	runs := []*Submission{
+		{RunID: 3, Result: "Partial solution 0/30", TestsTotal: 30},
+		{RunID: 2, Result: "Partial solution 12/30", TestsPassed: 12, TestsTotal: 30},
+		{RunID: 1, Result: "Compilation error"},
+	}
+	columns, err := parseRunColumns("run_id,tests_passed,tests_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := RunsCSV(runs, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// zero passed tests are written only if the total is known
+	expected := "run_id,tests_passed,tests_total\n3,0,30\n2,12,30\n1,,\n"
+	if string(raw) != expected {
+		t.Errorf("got %q, expected %q", raw, expected)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+)
+
+const selfTestMenu = `<div class="user_actions"><ul>
+<li class="contest_actions_item"><a href="/summary?SID=1">Summary</a></li>
+<li class="contest_actions_item"><a href="/standings?SID=1">Standings</a></li>
+<li class="contest_actions_item"><a href="/submissions?SID=1">Submissions</a></li>
+</ul></div>`
+
+// selfTestPages is a synthetic contest served by -selftest.
+var selfTestPages = map[string]string{
+	"/team.cgi": `<html><head><title>Self test - ejudge</title></head><body>
+<form action="/team.cgi" method="post">
+<input type="hidden" name="contest_id" value="1">
+<input type="text" name="login"><input type="password" name="password">
+<input type="submit" name="submit" value="Log in">
+</form></body></html>`,
+	"/contest": `<html><head><title>Self test - ejudge</title></head><body>
+<input type="hidden" name="contest_id" value="1">
+` + selfTestMenu + `</body></html>`,
+	"/summary": `<html><head><title>Self test - ejudge</title><link rel="stylesheet" href="/style.css"></head><body>
+` + selfTestMenu + `
+<h2>Problem summary</h2>
+<table class="b1">
+<tr><th>Short name</th><th>Long name</th><th>Status</th><th>Run ID</th></tr>
+<tr><td><a href="/statement?SID=1&amp;prob_id=1">A</a></td><td>A &amp; B</td><td>OK</td><td>3</td></tr>
+<tr><td><a href="/statement?SID=1&amp;prob_id=2">B</a></td><td>Strings</td><td>Wrong answer</td><td>2</td></tr>
+</table></body></html>`,
+	"/standings": `<html><head><meta http-equiv="Content-Type" content="text/html"></head><body>
+<table class="standings">
+<tr><th>Place</th><th>User</th><th>A</th><th>B</th></tr>
+<tr><td>1</td><td>selftest</td><td>+</td><td>-1</td></tr>
+</table></body></html>`,
+	"/submissions": `<html><body>
+<h2>Submissions</h2>
+<table class="b1">
+<tr><th>Run ID</th><th>Time</th><th>Problem</th><th>Language</th><th>Result</th><th>View source</th></tr>
+<tr><td>3</td><td>00:30:00</td><td>A</td><td>g++</td><td>OK</td><td><a href="/source?run_id=3">View</a></td></tr>
+<tr><td>2</td><td>00:20:00</td><td>B</td><td>python3</td><td>Wrong answer</td><td><a href="/source?run_id=2">View</a></td></tr>
+<tr><td>1</td><td>00:10:00</td><td>A</td><td>g++</td><td>Wrong answer</td><td><a href="/source?run_id=1">View</a></td></tr>
+</table></body></html>`,
+}
+
+var selfTestSources = map[string]string{
+	"1": "int main() { return 1; }\n",
+	"2": "print(input())\n",
+	"3": "int main() { return 0; }\n",
+}
+
+func selfTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/source" {
+		source, ok := selfTestSources[r.URL.Query().Get("run_id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, source)
+		return
+	}
+	path := r.URL.Path
+	if path == "/team.cgi" && r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("login") != "selftest" {
+			http.Error(w, "bad login", http.StatusForbidden)
+			return
+		}
+		path = "/contest"
+	}
+	page, ok := selfTestPages[path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+// SelfTest scrapes the bundled synthetic contest and checks the parsed data.
+func SelfTest(ctx context.Context) error {
+	srv := httptest.NewServer(http.HandlerFunc(selfTestHandler))
+	defer srv.Close()
+
+	p := &Parser{
+		Username:      "selftest",
+		Password:      "selftest",
+		ContestID:     1,
+		BaseURL:       srv.URL + "/team.cgi",
+		MinTLSVersion: "1.2",
+		RetryOn:       defaultRetryOn,
+		MaxSize:       1 << 20,
+	}
+	cli, err := p.newClient()
+	if err != nil {
+		return err
+	}
+	p.cli = cli
+
+	if err := p.GetData(ctx); err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, problem := range p.Problems {
+		problems = append(problems, fmt.Sprintf("%s:%s:%v", problem.ID, problem.Name, problem.OK))
+	}
+	var submissions []string
+	for _, submission := range p.Submissions {
+		submissions = append(submissions, fmt.Sprintf("%d:%s:%s", submission.RunID, submission.ProblemID, submission.Source))
+	}
+
+	for _, check := range []struct {
+		name          string
+		got, expected interface{}
+	}{
+		{"contest title", p.ContestTitle, "Self test"},
+		{"problems", problems, []string{"A:A & B:true", "B:Strings:false"}},
+		{"runs", len(p.Runs), 3},
+		{"submissions", submissions, []string{"3:A:" + selfTestSources["3"], "2:B:" + selfTestSources["2"]}},
+		{"solved in standings", p.Solved, []string{"A"}},
+	} {
+		if !reflect.DeepEqual(check.got, check.expected) {
+			return fmt.Errorf("%s: got %q, expected %q", check.name, check.got, check.expected)
+		}
+	}
+	return nil
+}
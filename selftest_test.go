@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(context.Background()); err != nil {
+		t.Fatalf("self test failed: %v", err)
+	}
+}
+
+func TestSelfTestDetectsMismatch(t *testing.T) {
+	page := selfTestPages["/summary"]
+	selfTestPages["/summary"] = strings.Replace(page, "<td>Strings</td>", "<td>Arrays</td>", 1)
+	t.Cleanup(func() { selfTestPages["/summary"] = page })
+
+	err := SelfTest(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "problems:") {
+		t.Fatalf("expected problems mismatch, got %v", err)
+	}
+}
+
+func TestSelfTestCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := SelfTest(ctx); err == nil {
+		t.Fatal("expected error on cancelled context")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+type SimilarPair struct {
+	A, B       *Submission
+	Similarity float64
+}
+
+// SimilarRuns is a pair of similar sources as written to similar.json.
+type SimilarRuns struct {
+	RunA, RunB         int
+	ProblemA, ProblemB string
+	Similarity         float64
+}
+
+func similarRuns(pairs []SimilarPair) []SimilarRuns {
+	res := make([]SimilarRuns, 0, len(pairs))
+	for _, pair := range pairs {
+		res = append(res, SimilarRuns{
+			RunA:       pair.A.RunID,
+			RunB:       pair.B.RunID,
+			ProblemA:   pair.A.ProblemID,
+			ProblemB:   pair.B.ProblemID,
+			Similarity: pair.Similarity,
+		})
+	}
+	return res
+}
+
+func tokenSet(source []byte) map[string]struct{} {
+	tokens := strings.FieldsFunc(string(source), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	set := make(map[string]struct{}, len(tokens))
+	for _, token := range tokens {
+		set[strings.ToLower(token)] = struct{}{}
+	}
+	return set
+}
+
+// jaccard returns size of intersection divided by size of union.
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	var common int
+	for token := range a {
+		if _, ok := b[token]; ok {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// CompareSources returns pairs of submissions whose token overlap reaches threshold.
+func CompareSources(submissions []*Submission, threshold float64) []SimilarPair {
+	sets := make([]map[string]struct{}, len(submissions))
+	for idx, submission := range submissions {
+		sets[idx] = tokenSet(submission.Source)
+	}
+
+	var res []SimilarPair
+	for i := range submissions {
+		for j := i + 1; j < len(submissions); j++ {
+			similarity := jaccard(sets[i], sets[j])
+			if similarity >= threshold {
+				res = append(res, SimilarPair{
+					A:          submissions[i],
+					B:          submissions[j],
+					Similarity: similarity,
+				})
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompareSources(t *testing.T) {
+	submissions := []*Submission{
+		{RunID: 1, ProblemID: "A", Source: []byte("int main() { int a, b; cin >> a >> b; }")},
+		{RunID: 2, ProblemID: "B", Source: []byte("int main() { int A, B; cin >> A >> B; }")},
+		{RunID: 3, ProblemID: "C", Source: []byte("print(sum(map(int, input().split())))")},
+	}
+	pairs := CompareSources(submissions, 0.9)
+	if len(pairs) != 1 || pairs[0].A.RunID != 1 || pairs[0].B.RunID != 2 || pairs[0].Similarity != 1 {
+		t.Fatalf("unexpected pairs %+v", pairs)
+	}
+	if pairs := CompareSources(submissions[:1], 0); len(pairs) != 0 {
+		t.Errorf("single source has no pairs, got %+v", pairs)
+	}
+}
+
+func TestCompareSourcesOfRuns(t *testing.T) {
+	final := &Submission{RunID: 3, ProblemID: "A", Source: []byte("int main() { return 0; }")}
+	attempt := &Submission{RunID: 1, ProblemID: "B", Source: []byte("int main() { return 0; }")}
+	p := &Parser{SimilarityThreshold: 0.5}
+	p.Submissions = []*Submission{final}
+	p.Runs = []*Submission{final, attempt}
+
+	if pairs := p.compareSources(); len(pairs) != 0 {
+		t.Errorf("final submissions only: unexpected pairs %+v", pairs)
+	}
+	p.IncludeDiffs = true
+	if pairs := p.compareSources(); len(pairs) != 1 {
+		t.Errorf("all runs: expected one pair, got %+v", pairs)
+	}
+}
+
+func TestWriteSimilar(t *testing.T) {
+	stubPdf(t)
+	p := &Parser{SimilarityThreshold: 0.5}
+	p.similar = []SimilarPair{{
+		A:          &Submission{RunID: 3, ProblemID: "A"},
+		B:          &Submission{RunID: 7, ProblemID: "A"},
+		Similarity: 0.75,
+	}}
+	sink := make(memSink)
+	if err := p.WriteData(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []SimilarRuns
+	if err := json.Unmarshal(sink["similar.json"], &got); err != nil {
+		t.Fatalf("decode similar.json: %v", err)
+	}
+	expected := []SimilarRuns{{RunA: 3, RunB: 7, ProblemA: "A", ProblemB: "A", Similarity: 0.75}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+}
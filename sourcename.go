@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultSourceName = "{{.ProblemID}}/main{{.Ext}}"
+	// runSourceName keeps several runs of one problem apart.
+	runSourceName = "{{.ProblemID}}/{{.RunID}}{{.Ext}}"
+)
+
+// SourceNameData is passed to the -source-name template.
+type SourceNameData struct {
+	ProblemID string
+	RunID     int
+	Language  string
+	Ext       string
+	Verdict   string
+}
+
+// parseSourceName parses the template and checks that it renders a path.
+func parseSourceName(text string) (*template.Template, error) {
+	tmpl, err := template.New("source-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse source name: %w", err)
+	}
+	name, err := renderSourceName(tmpl, SourceNameData{ProblemID: "A", RunID: 1, Language: "g++", Ext: ".cpp", Verdict: "OK"})
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("source name %q renders empty path", text)
+	}
+	return tmpl, nil
+}
+
+func renderSourceName(tmpl *template.Template, data SourceNameData) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", fmt.Errorf("render source name: %w", err)
+	}
+	return sanitizePath(buf.String()), nil
+}
+
+// sanitizePath makes name a relative path which can not leave the output dir.
+func sanitizePath(name string) string {
+	parts := strings.FieldsFunc(filepath.ToSlash(name), func(r rune) bool { return r == '/' })
+	clean := parts[:0]
+	for _, part := range parts {
+		part = strings.Map(func(r rune) rune {
+			if r < ' ' || strings.ContainsRune(`\:*?"<>|`, r) {
+				return '_'
+			}
+			return r
+		}, strings.TrimSpace(part))
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			part = "_"
+		}
+		clean = append(clean, part)
+	}
+	return filepath.Join(clean...)
+}
+
+// sourcePath renders output path of the submission source.
+func sourcePath(tmpl *template.Template, submission *Submission) (string, error) {
+	path, err := renderSourceName(tmpl, SourceNameData{
+		ProblemID: submission.ProblemID,
+		RunID:     submission.RunID,
+		Language:  submission.Language,
+		Ext:       filepath.Ext(fileName(submission.Language)),
+		Verdict:   submission.Result,
+	})
+	if err != nil {
+		return "", fmt.Errorf("run %d: %w", submission.RunID, err)
+	}
+	if path == "" {
+		return "", fmt.Errorf("run %d: empty source path", submission.RunID)
+	}
+	return path, nil
+}
+
+// setSourcePaths renders output paths of submission sources. Sources of different runs rendered to the same path
+// would overwrite each other, so it is an error.
+func setSourcePaths(tmpl *template.Template, submissions []*Submission) error {
+	runs := make(map[string]int, len(submissions))
+	for _, submission := range submissions {
+		path, err := sourcePath(tmpl, submission)
+		if err != nil {
+			return err
+		}
+		if runID, ok := runs[path]; ok && runID != submission.RunID {
+			return fmt.Errorf("runs %d and %d have the same source path %q, add {{.RunID}} to -source-name", runID, submission.RunID, path)
+		}
+		runs[path] = submission.RunID
+		submission.path = path
+	}
+	return nil
+}
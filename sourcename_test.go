@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizePath(t *testing.T) {
+	for raw, expected := range map[string]string{
+		"A/main.cpp":          filepath.Join("A", "main.cpp"),
+		"/abs//A/./main.cpp":  filepath.Join("abs", "A", "main.cpp"),
+		"../../etc/passwd":    filepath.Join("_", "_", "etc", "passwd"),
+		`A\main.cpp`:          "A_main.cpp",
+		"A/ OK: \"yes\" /1.c": filepath.Join("A", "OK_ _yes_", "1.c"),
+	} {
+		if got := sanitizePath(raw); got != expected {
+			t.Errorf("sanitizePath(%q) = %q, expected %q", raw, got, expected)
+		}
+	}
+}
+
+func TestSetSourcePaths(t *testing.T) {
+	if _, err := parseSourceName("{{.Missing}}"); err == nil {
+		t.Error("expected error on unknown field")
+	}
+	if _, err := parseSourceName("{{/* empty */}}"); err == nil {
+		t.Error("expected error on empty path")
+	}
+
+	submissions := []*Submission{
+		{RunID: 3, ProblemID: "A", Language: "g++", Result: "OK"},
+		{RunID: 2, ProblemID: "B", Language: "python3", Result: "Wrong answer"},
+	}
+	if err := setSourcePaths(mustSourceName(t, "{{.Verdict}}/{{.ProblemID}}-{{.RunID}}{{.Ext}}"), submissions); err != nil {
+		t.Fatal(err)
+	}
+	if submissions[0].path != filepath.Join("OK", "A-3.cpp") || submissions[1].path != filepath.Join("Wrong answer", "B-2.py") {
+		t.Errorf("got paths %q, %q", submissions[0].path, submissions[1].path)
+	}
+
+	err := setSourcePaths(mustSourceName(t, "{{.Language}}{{.Ext}}"), append(submissions, &Submission{RunID: 1, ProblemID: "A", Language: "g++"}))
+	if err == nil || !strings.Contains(err.Error(), "runs 3 and 1") {
+		t.Errorf("expected duplicate path error, got %v", err)
+	}
+}
+
+func TestSourcePathUnknownLanguage(t *testing.T) {
+	path, err := sourcePath(mustSourceName(t, defaultSourceName), &Submission{RunID: 4, ProblemID: "C", Language: "kotlin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join("C", "main.txt") {
+		t.Errorf("got path %q", path)
+	}
+}
+
+func TestStreamSourcesDuplicatePath(t *testing.T) {
+	sink := make(memSink)
+	onSource := streamSources(mustSourceName(t, defaultSourceName), []OutputSink{sink})
+	if err := onSource(&Submission{RunID: 3, ProblemID: "A", Language: "g++", Source: []byte("final")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := onSource(&Submission{RunID: 1, ProblemID: "A", Language: "g++", Source: []byte("attempt")}); err == nil {
+		t.Error("expected duplicate path error")
+	}
+	if got := string(sink[filepath.Join("A", "main.cpp")]); got != "final" {
+		t.Errorf("source is overwritten: %q", got)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+const stateFile = "state.json"
+
+// SourceState describes the source file of a run written by a previous run of the parser.
+type SourceState struct {
+	RunID     int
+	ProblemID string
+	OK        bool
+	// Path is relative to the output dir.
+	Path   string
+	SHA256 string
+}
+
+type ProblemState struct {
+	ID string
+	OK bool
+}
+
+type State struct {
+	Problems map[string]*ProblemState
+	Sources  map[int]*SourceState
+}
+
+const (
+	ChangeNew     = "new"
+	ChangeVerdict = "verdict-changed"
+	ChangeMissing = "missing"
+	ChangeSource  = "source-changed"
+)
+
+// Change describes a problem or a submission differing from the previous state.
+type Change struct {
+	// Kind is either "problem" or "submission".
+	Kind   string
+	ID     string
+	Change string
+	OK     bool
+}
+
+// Delta returns problems and submissions of next which are new or changed verdict since s.
+func (s *State) Delta(next *State) []Change {
+	prev := s
+	if prev == nil {
+		prev = new(State)
+	}
+
+	var changes []Change
+	ids := make([]string, 0, len(next.Problems))
+	for id := range next.Problems {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		problem := next.Problems[id]
+		change := Change{Kind: "problem", ID: id, OK: problem.OK}
+		if old, ok := prev.Problems[id]; !ok {
+			change.Change = ChangeNew
+		} else if old.OK != problem.OK {
+			change.Change = ChangeVerdict
+		} else {
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	runIDs := make([]int, 0, len(next.Sources))
+	for runID := range next.Sources {
+		runIDs = append(runIDs, runID)
+	}
+	sort.Ints(runIDs)
+	for _, runID := range runIDs {
+		source := next.Sources[runID]
+		change := Change{Kind: "submission", ID: strconv.Itoa(runID), OK: source.OK}
+		if old, ok := prev.Sources[runID]; !ok {
+			change.Change = ChangeNew
+		} else if old.OK != source.OK {
+			change.Change = ChangeVerdict
+		} else {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Mismatches returns every difference of live data from the snapshot s: delta of live, missing entries and changed sources.
+func (s *State) Mismatches(live *State) []Change {
+	changes := s.Delta(live)
+
+	ids := make([]string, 0, len(s.Problems))
+	for id := range s.Problems {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if _, ok := live.Problems[id]; !ok {
+			changes = append(changes, Change{Kind: "problem", ID: id, Change: ChangeMissing, OK: s.Problems[id].OK})
+		}
+	}
+
+	runIDs := make([]int, 0, len(s.Sources))
+	for runID := range s.Sources {
+		runIDs = append(runIDs, runID)
+	}
+	sort.Ints(runIDs)
+	for _, runID := range runIDs {
+		source := s.Sources[runID]
+		change := Change{Kind: "submission", ID: strconv.Itoa(runID), OK: source.OK}
+		if current, ok := live.Sources[runID]; !ok {
+			change.Change = ChangeMissing
+		} else if current.SHA256 != source.SHA256 {
+			change.Change = ChangeSource
+		} else {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func sourceHash(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadState reads state from the output dir. Missing state is not an error.
+func loadState(out string) (*State, error) {
+	state, err := readState(filepath.Join(out, stateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return state, err
+}
+
+// readState reads a state file, e.g. a snapshot for -verify.
+func readState(path string) (*State, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := new(State)
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("decode state: %q: %w", path, err)
+	}
+	return state, nil
+}
+
+func (s *State) save(sink OutputSink) error {
+	return writeJSON(sink, stateFile, s)
+}
+
+// cachedSource returns the previously written source of the submission if it is unchanged on disk.
+func (s *State) cachedSource(out string, submission *Submission) ([]byte, bool) {
+	if s == nil || submission.RunID == 0 {
+		return nil, false
+	}
+	prev, ok := s.Sources[submission.RunID]
+	if !ok || prev.ProblemID != submission.ProblemID {
+		return nil, false
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(out, prev.Path))
+	if err != nil || sourceHash(raw) != prev.SHA256 {
+		return nil, false
+	}
+	return raw, true
+}
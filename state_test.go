@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCachedSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if state, err := loadState(dir); err != nil || state != nil {
+		t.Fatalf("missing state: got %v, %v", state, err)
+	}
+
+	source := []byte("int main() {}\n")
+	p := &Parser{}
+	p.Problems = []*Problem{{ID: "A", OK: true}}
+	p.Submissions = []*Submission{{RunID: 3, ProblemID: "A", OK: true, Source: source, path: "A/main.cpp"}}
+	sink := &DirSink{Dir: dir}
+	if err := sink.WriteFile("A/main.cpp", source); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.newState().save(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := loadState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, ok := state.cachedSource(dir, &Submission{RunID: 3, ProblemID: "A"}); !ok || string(raw) != string(source) {
+		t.Errorf("unchanged source: got %q, %v", raw, ok)
+	}
+	if _, ok := state.cachedSource(dir, &Submission{RunID: 4, ProblemID: "A"}); ok {
+		t.Error("new run must not be cached")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "A", "main.cpp"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.cachedSource(dir, &Submission{RunID: 3, ProblemID: "A"}); ok {
+		t.Error("source changed on disk must not be cached")
+	}
+}
+
+func TestLoadSourceCached(t *testing.T) {
+	se := &SubmissionsEmitter{
+		// no client, fetching would panic
+		cached: func(submission *Submission) ([]byte, bool) {
+			return []byte("cached"), true
+		},
+	}
+	submission := &Submission{RunID: 3}
+	if err := se.loadSource(context.Background(), []*Submission{submission}); err != nil {
+		t.Fatal(err)
+	}
+	if string(submission.Source) != "cached" {
+		t.Errorf("got %q", submission.Source)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	prev := &State{
+		Problems: map[string]*ProblemState{"A": {ID: "A", OK: false}, "B": {ID: "B", OK: true}},
+		Sources:  map[int]*SourceState{1: {RunID: 1, ProblemID: "B", OK: true}},
+	}
+	next := &State{
+		Problems: map[string]*ProblemState{"A": {ID: "A", OK: true}, "B": {ID: "B", OK: true}, "C": {ID: "C"}},
+		Sources: map[int]*SourceState{
+			1: {RunID: 1, ProblemID: "B", OK: true},
+			5: {RunID: 5, ProblemID: "A", OK: true},
+		},
+	}
+	expected := []Change{
+		{Kind: "problem", ID: "A", Change: ChangeVerdict, OK: true},
+		{Kind: "problem", ID: "C", Change: ChangeNew},
+		{Kind: "submission", ID: "5", Change: ChangeNew, OK: true},
+	}
+	if got := prev.Delta(next); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+
+	// without previous state everything is new
+	var missing *State
+	if got := missing.Delta(next); len(got) != 5 {
+		t.Errorf("got %d changes without previous state, expected 5", len(got))
+	}
+}
+
+func TestWriteDelta(t *testing.T) {
+	p := &Parser{state: &State{Problems: map[string]*ProblemState{"A": {ID: "A"}}}}
+	p.Problems = []*Problem{{ID: "A", OK: true}}
+
+	sink := make(memSink)
+	if err := p.WriteDelta(sink); err != nil {
+		t.Fatal(err)
+	}
+	var changes []Change
+	if err := json.Unmarshal(sink["delta.json"], &changes); err != nil {
+		t.Fatalf("decode delta.json: %v", err)
+	}
+	if expected := []Change{{Kind: "problem", ID: "A", Change: ChangeVerdict, OK: true}}; !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got %+v, expected %+v", changes, expected)
+	}
+	if _, ok := sink[stateFile]; !ok {
+		t.Error("state is not updated")
+	}
+}
+
+func TestMismatches(t *testing.T) {
+	snapshot := &State{
+		Problems: map[string]*ProblemState{"A": {ID: "A", OK: true}, "B": {ID: "B"}},
+		Sources: map[int]*SourceState{
+			1: {RunID: 1, ProblemID: "A", OK: true, SHA256: "aa"},
+			2: {RunID: 2, ProblemID: "B", SHA256: "bb"},
+		},
+	}
+	live := &State{
+		Problems: map[string]*ProblemState{"A": {ID: "A", OK: true}},
+		Sources:  map[int]*SourceState{1: {RunID: 1, ProblemID: "A", OK: true, SHA256: "cc"}},
+	}
+	expected := []Change{
+		{Kind: "problem", ID: "B", Change: ChangeMissing},
+		{Kind: "submission", ID: "1", Change: ChangeSource, OK: true},
+		{Kind: "submission", ID: "2", Change: ChangeMissing},
+	}
+	if got := snapshot.Mismatches(live); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, expected %+v", got, expected)
+	}
+	if got := snapshot.Mismatches(snapshot); len(got) != 0 {
+		t.Errorf("snapshot differs from itself: %+v", got)
+	}
+}
+
+func TestVerifyRun(t *testing.T) {
+	stubPdf(t)
+	dir, err := ioutil.TempDir("", "contest-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, _ := newSelfTestParser(t)
+	p.Incremental = true
+	p.Outputs = stringsFlag{filepath.Join(dir, "snapshot")}
+	p.Output = p.Outputs[0]
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(dir, "snapshot", stateFile)
+
+	verify := func() error {
+		p, _ := newSelfTestParser(t)
+		p.Verify = snapshot
+		p.Outputs = stringsFlag{filepath.Join(dir, "verify")}
+		p.Output = p.Outputs[0]
+		return p.Run(context.Background())
+	}
+	if err := verify(); err != nil {
+		t.Fatalf("unchanged contest: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "verify")); !os.IsNotExist(err) {
+		t.Error("verification run wrote output")
+	}
+
+	state, err := readState(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Sources[3].SHA256 = sourceHash([]byte("edited"))
+	if err := state.save(&DirSink{Dir: filepath.Dir(snapshot)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(); err == nil || !strings.Contains(err.Error(), "1 mismatches") {
+		t.Errorf("expected one mismatch, got %v", err)
+	}
+}
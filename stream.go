@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"text/template"
+)
+
+// checkStreamSources rejects options which need all sources in memory after fetching.
+func (p *Parser) checkStreamSources() error {
+	switch {
+	case p.IncludeDiffs:
+		return errors.New("-stream-sources can not be used with -include-diffs")
+	case p.VerifyCompile:
+		return errors.New("-stream-sources can not be used with -verify-compile")
+	case p.SimilarityThreshold > 0:
+		return errors.New("-stream-sources can not be used with -similarity-threshold")
+	case p.Verify != "":
+		return errors.New("-stream-sources can not be used with -verify")
+	case p.Incremental || p.DeltaOnly:
+		return errors.New("-stream-sources can not be used with -incremental or -delta-only")
+	case p.Format != "":
+		return errors.New("-stream-sources can not be used with -format, the report includes sources")
+	}
+	for _, column := range p.runColumns {
+		if column == "size" {
+			return errors.New("-stream-sources can not be used with size column of -runs-csv-columns")
+		}
+	}
+	return nil
+}
+
+// streamSources returns a callback writing every fetched source to all sinks.
+func streamSources(tmpl *template.Template, sinks []OutputSink) func(*Submission) error {
+	runs := make(map[string]int)
+	return func(submission *Submission) error {
+		path, err := sourcePath(tmpl, submission)
+		if err != nil {
+			return err
+		}
+		if runID, ok := runs[path]; ok && runID != submission.RunID {
+			return fmt.Errorf("runs %d and %d have the same source path %q, add {{.RunID}} to -source-name", runID, submission.RunID, path)
+		}
+		runs[path] = submission.RunID
+		submission.path = path
+		for _, sink := range sinks {
+			if err := sink.WriteFile(submission.path, submission.Source); err != nil {
+				return err
+			}
+		}
+		submission.streamed = true
+		return nil
+	}
+}
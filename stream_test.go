@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// discardSink counts written bytes and drops the data.
+type discardSink struct {
+	files int
+	bytes int
+}
+
+func (d *discardSink) WriteFile(_ string, data []byte) error {
+	d.files++
+	d.bytes += len(data)
+	return nil
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestStreamSourcesMemory(t *testing.T) {
+	const (
+		runs       = 32
+		sourceSize = 1 << 20
+	)
+	source := strings.Repeat("x", sourceSize-1) + "\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/source" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(source))
+			return
+		}
+		var rows strings.Builder
+		for runID := runs; runID > 0; runID-- {
+			fmt.Fprintf(&rows, `<tr><td>%d</td><td>P%d</td><td>g++</td><td>OK</td><td><a href="/source?run_id=%d">View</a></td></tr>`, runID, runID, runID)
+		}
+		fmt.Fprintf(w, `<html><body><h2>Submissions</h2><table class="b1">
+<tr><th>Run ID</th><th>Problem</th><th>Language</th><th>Result</th><th>View source</th></tr>%s</table></body></html>`, rows.String())
+	}))
+	defer srv.Close()
+
+	p := newTestParser(t, srv.URL)
+	u, _ := url.Parse(srv.URL + "/submissions")
+	p.InitEmitters(u)
+	p.SubmissionsEmitter.maxSize = 2 * sourceSize
+	sink := new(discardSink)
+	p.SubmissionsEmitter.onSource = streamSources(mustSourceName(t, defaultSourceName), []OutputSink{sink})
+
+	before := heapAlloc()
+	if err := p.Do(context.Background(), u, &p.SubmissionsEmitter); err != nil {
+		t.Fatal(err)
+	}
+	after := heapAlloc()
+
+	if sink.files != runs || sink.bytes != runs*sourceSize {
+		t.Errorf("streamed %d files, %d bytes", sink.files, sink.bytes)
+	}
+	for _, submission := range p.Submissions {
+		if submission.Source != nil || !submission.streamed {
+			t.Fatalf("run %d: source is retained after streaming", submission.RunID)
+		}
+	}
+	// sources are not kept, so the heap does not grow by their total size
+	if after > before && after-before > runs*sourceSize/4 {
+		t.Errorf("heap grew by %d bytes after streaming %d bytes", after-before, runs*sourceSize)
+	}
+}
+
+func TestCheckStreamSources(t *testing.T) {
+	for name, p := range map[string]*Parser{
+		"include diffs": {IncludeDiffs: true},
+		"report":        {Format: "md"},
+		"csv size":      {RunsCSV: true, runColumns: []string{"run_id", "size"}},
+	} {
+		if err := p.checkStreamSources(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	p := &Parser{RunsCSV: true, runColumns: []string{"run_id", "verdict"}}
+	if err := p.checkStreamSources(); err != nil {
+		t.Errorf("csv without size: %v", err)
+	}
+}